@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	loginTimeout = 10 * time.Second
+	drainTimeout = 5 * time.Second
+
+	// tokenClockSkew allows for the clock of whoever issued a token being a
+	// little ahead of ours.
+	tokenClockSkew = 1 * time.Minute
+)
+
+// The gateway lets browsers play over WebSocket, so the message broker
+// never has to be exposed to the internet. Each connection gets its own
+// broker connection and GameState, just like a terminal client.
+func main() {
+	addr := flag.String("addr", ":8081", "address to accept WebSocket connections on")
+	secret := flag.String("secret", "", "secret used to sign and check login tokens")
+	origin := flag.String("origin", "", "origin browsers must connect from, empty to allow any")
+	issue := flag.String("issue", "", "print a login token for this username and exit")
+	tokenTTL := flag.Duration("token-ttl", 24*time.Hour, "how long login tokens are accepted after they are issued")
+	brokerOpts := pubsub.DialOptions{}
+	config.RegisterBroker(flag.CommandLine, &brokerOpts)
+	printConfig, err := config.Parse(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load config: %v\n", err)
+	}
+	if printConfig {
+		config.Print(os.Stdout, flag.CommandLine)
+		return
+	}
+
+	if *secret == "" {
+		log.Fatalf("The gateway needs a secret, set one with -secret\n")
+	}
+
+	if *issue != "" {
+		fmt.Println(loginToken(*secret, *issue, time.Now()))
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return *origin == "" || r.Header.Get("Origin") == *origin
+		},
+	}
+
+	http.HandleFunc("/play", func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("Failed to upgrade connection: %v\n", err)
+			return
+		}
+		defer ws.Close()
+
+		username, err := login(ws, *secret, *tokenTTL)
+		if err != nil {
+			writeMessage(ws, serverMessage{Type: "error", Error: err.Error()})
+			return
+		}
+
+		s, err := newSession(username, ws, brokerOpts)
+		if err != nil {
+			log.Printf("Failed to start session for %s: %v\n", username, err)
+			writeMessage(ws, serverMessage{Type: "error", Error: "could not join the game"})
+			return
+		}
+		defer s.close()
+
+		log.Printf("%s connected\n", username)
+		s.run()
+		log.Printf("%s disconnected\n", username)
+	})
+
+	fmt.Printf("Starting Peril gateway on %s...\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// login reads the first message from a connection, which must name the
+// player and carry a token signed with the gateway's secret no longer than
+// ttl ago.
+func login(ws *websocket.Conn, secret string, ttl time.Duration) (string, error) {
+	ws.SetReadDeadline(time.Now().Add(loginTimeout))
+	defer ws.SetReadDeadline(time.Time{})
+
+	var msg clientMessage
+	err := ws.ReadJSON(&msg)
+	if err != nil {
+		return "", fmt.Errorf("expected a login message")
+	}
+	if msg.Type != "login" || msg.Username == "" {
+		return "", fmt.Errorf("expected a login message")
+	}
+
+	err = checkLoginToken(secret, msg.Username, msg.Token, ttl, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return msg.Username, nil
+}
+
+// loginToken signs a username and when the token was issued, which is
+// carried in the token as Unix seconds so it can expire.
+func loginToken(secret, username string, issued time.Time) string {
+	unix := strconv.FormatInt(issued.Unix(), 10)
+	return fmt.Sprintf("%s.%s", unix, signLogin(secret, username, unix))
+}
+
+func checkLoginToken(secret, username, token string, ttl time.Duration, now time.Time) error {
+	unix, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signLogin(secret, username, unix))) {
+		return fmt.Errorf("invalid token for %s", username)
+	}
+	secs, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid token for %s", username)
+	}
+	issued := time.Unix(secs, 0)
+	if issued.After(now.Add(tokenClockSkew)) {
+		return fmt.Errorf("token for %s is issued in the future", username)
+	}
+	if now.Sub(issued) > ttl {
+		return fmt.Errorf("token for %s has expired", username)
+	}
+	return nil
+}
+
+func signLogin(secret, username, unix string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(username))
+	mac.Write([]byte{0})
+	mac.Write([]byte(unix))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/gorilla/websocket"
+)
+
+// clientMessage is a command sent by the browser.
+type clientMessage struct {
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Location string `json:"location,omitempty"`
+	Rank     string `json:"rank,omitempty"`
+	Units    []int  `json:"units,omitempty"`
+}
+
+// serverMessage is an event, command result or error sent to the browser.
+type serverMessage struct {
+	Type  string `json:"type"`
+	Event string `json:"event,omitempty"`
+	Data  any    `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// session bridges one WebSocket connection to the game.
+type session struct {
+	gameState *gamelogic.GameState
+	ws        *websocket.Conn
+	transport pubsub.Transport
+	exit      chan struct{}
+	mu        *sync.Mutex
+}
+
+func newSession(username string, ws *websocket.Conn, brokerOpts pubsub.DialOptions) (*session, error) {
+	transport, err := pubsub.Dial(brokerOpts)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect: %v", err)
+	}
+
+	s := &session{
+		gameState: gamelogic.NewGameState(username),
+		ws:        ws,
+		transport: transport,
+		exit:      make(chan struct{}, 1),
+		mu:        &sync.Mutex{},
+	}
+
+	err = s.subscribe()
+	if err != nil {
+		transport.Close()
+		return nil, err
+	}
+
+	err = pubsub.PublishJSON(
+		transport,
+		routing.ExchangePerilTopic,
+		fmt.Sprintf("%s.%s", routing.JoinPrefix, username),
+		routing.Join{Username: username},
+	)
+	if err != nil {
+		transport.Close()
+		return nil, fmt.Errorf("could not join game: %v", err)
+	}
+
+	return s, nil
+}
+
+// close lets running handlers finish and tells the server the player has
+// left, then tears down every transient queue the session declared along
+// with its connection.
+func (s *session) close() {
+	err := s.transport.Drain(drainTimeout)
+	if err != nil {
+		log.Printf("Failed to drain: %v\n", err)
+	}
+
+	username := s.gameState.GetUsername()
+	err = pubsub.PublishJSON(
+		s.transport,
+		routing.ExchangePerilTopic,
+		fmt.Sprintf("%s.%s", routing.LeavePrefix, username),
+		routing.Leave{Username: username},
+	)
+	if err != nil {
+		log.Printf("Failed to leave game for %s: %v\n", username, err)
+	}
+
+	err = s.transport.Close()
+	if err != nil {
+		log.Printf("Failed to close connection: %v\n", err)
+	}
+}
+
+func (s *session) subscribe() error {
+	username := s.gameState.GetUsername()
+
+	err := pubsub.SubscribeJSON(
+		s.transport,
+		routing.ExchangePerilDirect,
+		fmt.Sprintf("%s.%s", routing.PauseKey, username),
+		routing.PauseKey,
+		pubsub.Transient,
+		func(ps routing.PlayingState) pubsub.AckType {
+			s.gameState.HandlePause(ps)
+			s.sendEvent("pause", ps)
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to pause: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		s.transport,
+		routing.ExchangePerilTopic,
+		fmt.Sprintf("%s.%s", routing.VisibleMovesPrefix, username),
+		fmt.Sprintf("%s.%s", routing.VisibleMovesPrefix, username),
+		pubsub.Transient,
+		s.handlerArmyMove,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to army moves: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		s.transport,
+		routing.ExchangePerilTopic,
+		routing.WarRecognitionsPrefix,
+		fmt.Sprintf("%s.*", routing.WarRecognitionsPrefix),
+		pubsub.Durable,
+		s.handlerWar,
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to war: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		s.transport,
+		routing.ExchangePerilTopic,
+		fmt.Sprintf("%s.%s", routing.CasualtiesPrefix, username),
+		fmt.Sprintf("%s.%s", routing.CasualtiesPrefix, username),
+		pubsub.Transient,
+		func(result gamelogic.WarResult) pubsub.AckType {
+			s.gameState.HandleCasualties(result)
+			s.sendEvent("casualties", result)
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to casualties: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		s.transport,
+		routing.ExchangePerilTopic,
+		fmt.Sprintf("%s.%s", routing.IncomePrefix, username),
+		fmt.Sprintf("%s.%s", routing.IncomePrefix, username),
+		pubsub.Transient,
+		func(inc gamelogic.Income) pubsub.AckType {
+			s.gameState.HandleIncome(inc)
+			s.sendEvent("income", inc)
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to income: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		s.transport,
+		routing.ExchangePerilTopic,
+		fmt.Sprintf("%s.%s", routing.ViewPrefix, username),
+		fmt.Sprintf("%s.%s", routing.ViewPrefix, username),
+		pubsub.Transient,
+		func(v gamelogic.View) pubsub.AckType {
+			s.gameState.HandleView(v)
+			s.sendEvent("view", v)
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to views: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		s.transport,
+		routing.ExchangePerilTopic,
+		fmt.Sprintf("%s.%s", routing.RestorePrefix, username),
+		fmt.Sprintf("%s.%s", routing.RestorePrefix, username),
+		pubsub.Transient,
+		func(snapshot gamelogic.Snapshot) pubsub.AckType {
+			s.gameState.HandleRestore(snapshot)
+			s.sendEvent("restore", s.gameState.GetStatus())
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to restore: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		s.transport,
+		routing.ExchangePerilDirect,
+		fmt.Sprintf("%s.%s", routing.GameOverKey, username),
+		routing.GameOverKey,
+		pubsub.Transient,
+		func(g gamelogic.GameOver) pubsub.AckType {
+			s.gameState.HandleGameOver(g)
+			s.sendEvent("game_over", g)
+			s.end()
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to game over: %v", err)
+	}
+
+	err = pubsub.SubscribeJSON(
+		s.transport,
+		routing.ExchangePerilDirect,
+		fmt.Sprintf("%s.%s", routing.AdminPrefix, username),
+		fmt.Sprintf("%s.%s", routing.AdminPrefix, username),
+		pubsub.Transient,
+		func(msg routing.AdminMessage) pubsub.AckType {
+			removed := s.gameState.HandleAdmin(msg)
+			s.sendEvent("admin", msg)
+			if removed {
+				s.end()
+			}
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to admin: %v", err)
+	}
+
+	return nil
+}
+
+func (s *session) handlerArmyMove(move gamelogic.ArmyMove) pubsub.AckType {
+	outcome := s.gameState.HandleMove(move)
+	if s.gameState.CanSeeMove(move) {
+		s.sendEvent("move", move)
+	}
+
+	switch outcome {
+	case gamelogic.MoveOutComeSafe, gamelogic.MoveOutcomeSamePlayer:
+		return pubsub.Ack
+
+	case gamelogic.MoveOutcomeMakeWar:
+		err := pubsub.PublishJSON(
+			s.transport,
+			routing.ExchangePerilTopic,
+			fmt.Sprintf("%s.%s", routing.WarRecognitionsPrefix, s.gameState.GetUsername()),
+			s.gameState.NewRecognitionOfWar(move),
+		)
+		if err != nil {
+			log.Printf("Failed to publish move outcome: %v\n", err)
+			return pubsub.NackRequeue
+		}
+		return pubsub.NackDiscard
+
+	default:
+		return pubsub.NackDiscard
+	}
+}
+
+func (s *session) handlerWar(rw gamelogic.RecognitionOfWar) pubsub.AckType {
+	outcome, result := s.gameState.HandleWar(rw)
+	if outcome == gamelogic.WarOutcomeNotInvolved {
+		return pubsub.NackRequeue
+	}
+	msg, fought := gamelogic.DescribeWar(outcome, result)
+	if !fought {
+		return pubsub.NackDiscard
+	}
+	s.sendEvent("war", result)
+
+	err := pubsub.PublishGob(
+		s.transport,
+		routing.ExchangePerilTopic,
+		fmt.Sprintf("%s.%s", routing.GameLogSubmitPrefix, s.gameState.GetUsername()),
+		routing.GameLog{
+			CurrentTime: time.Now(),
+			Message:     msg,
+			Username:    s.gameState.GetUsername(),
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to publish game log: %v\n", err)
+		return pubsub.NackRequeue
+	}
+
+	err = pubsub.PublishJSON(
+		s.transport,
+		routing.ExchangePerilTopic,
+		fmt.Sprintf("%s.%s", routing.WarResultsPrefix, s.gameState.GetUsername()),
+		result,
+	)
+	if err != nil {
+		log.Printf("Failed to publish war result: %v\n", err)
+		return pubsub.NackRequeue
+	}
+
+	return pubsub.Ack
+}
+
+// run handles commands from the browser until it disconnects or the
+// player is removed from the game.
+func (s *session) run() {
+	msgs := make(chan clientMessage)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(msgs)
+		for {
+			var msg clientMessage
+			err := s.ws.ReadJSON(&msg)
+			if err != nil {
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	s.send(serverMessage{Type: "status", Data: s.gameState.GetStatus()})
+	for {
+		select {
+		case <-s.exit:
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			s.handle(msg)
+		}
+	}
+}
+
+func (s *session) handle(msg clientMessage) {
+	username := s.gameState.GetUsername()
+
+	switch msg.Type {
+	case "spawn":
+		spawn, err := s.gameState.CommandSpawn([]string{"spawn", msg.Location, msg.Rank})
+		if err != nil {
+			s.sendError(err)
+			return
+		}
+		err = pubsub.PublishJSON(
+			s.transport,
+			routing.ExchangePerilTopic,
+			fmt.Sprintf("%s.%s", routing.SpawnsPrefix, username),
+			spawn,
+		)
+		if err != nil {
+			s.sendError(err)
+			return
+		}
+		s.send(serverMessage{Type: "spawned", Data: spawn})
+
+	case "move":
+		words := []string{"move", msg.Location}
+		for _, id := range msg.Units {
+			words = append(words, strconv.Itoa(id))
+		}
+		move, err := s.gameState.CommandMove(words)
+		if err != nil {
+			s.sendError(err)
+			return
+		}
+		err = pubsub.PublishJSON(
+			s.transport,
+			routing.ExchangePerilTopic,
+			fmt.Sprintf("%s.%s", routing.ArmyMovesPrefix, username),
+			move,
+		)
+		if err != nil {
+			s.sendError(err)
+			return
+		}
+		s.send(serverMessage{Type: "moved", Data: move})
+
+	case "status":
+		s.send(serverMessage{Type: "status", Data: s.gameState.GetStatus()})
+
+	default:
+		s.sendError(fmt.Errorf("unknown command: %q", msg.Type))
+	}
+}
+
+// end stops the session after the player is removed from the game.
+func (s *session) end() {
+	select {
+	case s.exit <- struct{}{}:
+	default:
+	}
+}
+
+func (s *session) sendEvent(event string, data any) {
+	s.send(serverMessage{Type: "event", Event: event, Data: data})
+}
+
+func (s *session) sendError(err error) {
+	s.send(serverMessage{Type: "error", Error: err.Error()})
+}
+
+// send is safe to call from the subscription goroutines, since a
+// WebSocket only allows one writer at a time.
+func (s *session) send(msg serverMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeMessage(s.ws, msg)
+}
+
+func writeMessage(ws *websocket.Conn, msg serverMessage) {
+	err := ws.WriteJSON(msg)
+	if err != nil {
+		log.Printf("Failed to write message: %v\n", err)
+	}
+}
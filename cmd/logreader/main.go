@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const drainTimeout = 5 * time.Second
+
+// logreader prints the game log stream, independently of the server's own
+// reader, starting from any offset.
+func main() {
+	offsetFlag := flag.String("offset", "first", "where to start reading: first, last, next, an RFC 3339 time or an offset")
+	brokerOpts := pubsub.DialOptions{}
+	config.RegisterBroker(flag.CommandLine, &brokerOpts)
+	printConfig, err := config.Parse(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load config: %v\n", err)
+	}
+	if printConfig {
+		config.Print(os.Stdout, flag.CommandLine)
+		return
+	}
+
+	offset, err := pubsub.ParseStreamOffset(*offsetFlag)
+	if err != nil {
+		log.Fatalf("Failed to parse offset: %v\n", err)
+	}
+
+	transport, err := pubsub.Dial(brokerOpts)
+	if err != nil {
+		log.Fatalf("Failed to connect: %v\n", err)
+	}
+	defer transport.Close()
+
+	fmt.Printf("Reading game logs from %v...\n", offset)
+	err = pubsub.SubscribeStreamGob(
+		transport,
+		routing.ExchangePerilTopic,
+		routing.GameLogStream,
+		fmt.Sprintf("%s.*", routing.GameLogSlug),
+		offset,
+		func(gl routing.GameLog) pubsub.AckType {
+			fmt.Printf("%v %v: %v\n", gl.CurrentTime.Format(time.RFC3339), gl.Username, gl.Message)
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		log.Fatalf("Failed to subscribe to game logs: %v\n", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	err = transport.Drain(drainTimeout)
+	if err != nil {
+		log.Printf("Failed to drain: %v\n", err)
+	}
+}
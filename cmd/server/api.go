@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logsink"
+)
+
+// newAPI serves the operator commands as JSON over HTTP. Every request
+// must carry the token as a bearer token.
+func newAPI(cmds *commands, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		respondDone(w, cmds.setPaused(true))
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		respondDone(w, cmds.setPaused(false))
+	})
+	mux.HandleFunc("GET /players", func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, http.StatusOK, cmds.players())
+	})
+	mux.HandleFunc("GET /games", func(w http.ResponseWriter, r *http.Request) {
+		saves, err := cmds.games()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, saves)
+	})
+	mux.HandleFunc("GET /logs", func(w http.ResponseWriter, r *http.Request) {
+		// Reuse the REPL's key=value syntax so both accept the same filters
+		words := []string{}
+		for _, key := range []string{"user", "since", "until", "text", "limit"} {
+			if v := r.URL.Query().Get(key); v != "" {
+				words = append(words, fmt.Sprintf("%s=%s", key, v))
+			}
+		}
+		filter, err := logsink.ParseFilter(words, time.Now())
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		gls, err := cmds.queryLogs(filter)
+		if errors.Is(err, errNoLogFile) {
+			respondError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, gls)
+	})
+	mux.HandleFunc("POST /players/{username}/kick", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		respondDone(w, cmds.kick(r.PathValue("username"), body.Reason))
+	})
+	mux.HandleFunc("POST /players/{username}/ban", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Duration string `json:"duration"`
+			Reason   string `json:"reason"`
+		}
+		if !decodeBody(w, r, &body) {
+			return
+		}
+		var duration time.Duration
+		if body.Duration != "" {
+			d, err := time.ParseDuration(body.Duration)
+			if err != nil || d <= 0 {
+				respondError(w, http.StatusBadRequest, fmt.Errorf("invalid duration: %q", body.Duration))
+				return
+			}
+			duration = d
+		}
+		respondDone(w, cmds.ban(r.PathValue("username"), duration, body.Reason))
+	})
+	mux.HandleFunc("GET /bans", func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, http.StatusOK, cmds.listBans())
+	})
+	mux.HandleFunc("DELETE /bans/{username}", func(w http.ResponseWriter, r *http.Request) {
+		ok, err := cmds.unban(r.PathValue("username"))
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			respondError(w, http.StatusNotFound, fmt.Errorf("%s is not banned", r.PathValue("username")))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return requireToken(token, mux)
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeBody reads an optional JSON body, responding with an error if it
+// is malformed.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func respondDone(w http.ResponseWriter, err error) {
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondError(w http.ResponseWriter, status int, err error) {
+	respondJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func respondJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("Failed to write response: %v\n", err)
+	}
+}
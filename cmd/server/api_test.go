@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logsink"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/moderation"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const testToken = "secret"
+
+// fakeTransport records what is published and ignores everything else.
+type fakeTransport struct {
+	published []string
+	mu        *sync.Mutex
+}
+
+func (t *fakeTransport) Publish(exchange, key string, msg pubsub.Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.published = append(t.published, key)
+	return nil
+}
+
+func (t *fakeTransport) Subscribe(exchange, queueName, key string, cfg pubsub.QueueConfig, handler func(pubsub.Message) pubsub.AckType) error {
+	return nil
+}
+
+func (t *fakeTransport) SubscribeStream(exchange, streamName, key string, offset pubsub.StreamOffset, handler func(pubsub.Message) pubsub.AckType) error {
+	return nil
+}
+
+func (t *fakeTransport) DeclareStream(exchange, streamName, key string) error {
+	return nil
+}
+
+func (t *fakeTransport) Serve(exchange, queueName, key string, handler func(pubsub.Message) (pubsub.Message, error)) error {
+	return nil
+}
+
+func (t *fakeTransport) Call(exchange, key string, req pubsub.Message, timeout time.Duration) (pubsub.Message, error) {
+	return pubsub.Message{}, nil
+}
+
+func (t *fakeTransport) Drain(timeout time.Duration) error {
+	return nil
+}
+
+func (t *fakeTransport) Close() error {
+	return nil
+}
+
+func (t *fakeTransport) keys() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string{}, t.published...)
+}
+
+// newTestAPI serves the admin API over commands backed by files in a
+// temporary directory, which is also the working directory so saves land
+// there.
+func newTestAPI(t *testing.T) (*httptest.Server, *commands, *fakeTransport) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	events, err := gamelogic.OpenEventLog(filepath.Join(dir, "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { events.Close() })
+
+	bans, err := moderation.LoadBans(filepath.Join(dir, "bans.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logsPath := filepath.Join(dir, "game.log")
+	logs, err := logsink.NewRotatingFile(logsink.Options{
+		Path:          logsPath,
+		MaxBytes:      logsMaxBytes,
+		MaxAge:        logsMaxAge,
+		FlushInterval: logsFlushInterval,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logs.Close() })
+
+	transport := &fakeTransport{mu: &sync.Mutex{}}
+	cmds := &commands{
+		transport: transport,
+		world:     gamelogic.NewWorld(),
+		treaties:  gamelogic.NewTreaties(),
+		events:    events,
+		logs:      logs,
+		logsPath:  logsPath,
+		bans:      bans,
+		moderator: moderation.NewModerator(moderation.Options{}, func(routing.GameLog) {}),
+	}
+
+	srv := httptest.NewServer(newAPI(cmds, testToken))
+	t.Cleanup(srv.Close)
+	return srv, cmds, transport
+}
+
+func doRequest(t *testing.T, srv *httptest.Server, method, path, token, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func decodeResponse(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+	err := json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+}
+
+func expectStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+	if resp.StatusCode != want {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, want, body)
+	}
+}
+
+func TestAPIRejectsBadTokens(t *testing.T) {
+	srv, _, transport := newTestAPI(t)
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"missing", ""},
+		{"wrong token", "Bearer wrong"},
+		{"not bearer", "Basic " + testToken},
+		{"bare token", testToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/pause", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			expectStatus(t, resp, http.StatusUnauthorized)
+			if got := resp.Header.Get("WWW-Authenticate"); got != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", got)
+			}
+		})
+	}
+
+	if keys := transport.keys(); len(keys) != 0 {
+		t.Errorf("unauthorized requests published %v", keys)
+	}
+}
+
+func TestAPIPauseAndResume(t *testing.T) {
+	srv, cmds, transport := newTestAPI(t)
+
+	resp := doRequest(t, srv, http.MethodPost, "/pause", testToken, "")
+	expectStatus(t, resp, http.StatusNoContent)
+	if !cmds.world.IsPaused() {
+		t.Error("world not paused after POST /pause")
+	}
+
+	resp = doRequest(t, srv, http.MethodPost, "/resume", testToken, "")
+	expectStatus(t, resp, http.StatusNoContent)
+	if cmds.world.IsPaused() {
+		t.Error("world still paused after POST /resume")
+	}
+
+	keys := transport.keys()
+	if len(keys) != 2 || keys[0] != routing.PauseKey || keys[1] != routing.PauseKey {
+		t.Errorf("published %v, want two pause messages", keys)
+	}
+}
+
+func TestAPIPlayers(t *testing.T) {
+	srv, cmds, _ := newTestAPI(t)
+	cmds.world.AddPlayer("alice")
+
+	resp := doRequest(t, srv, http.MethodGet, "/players", testToken, "")
+	expectStatus(t, resp, http.StatusOK)
+	var players []playerStatus
+	decodeResponse(t, resp, &players)
+	if len(players) != 1 || players[0].Username != "alice" || !players[0].Online {
+		t.Errorf("players = %+v, want alice online", players)
+	}
+}
+
+func TestAPIGames(t *testing.T) {
+	srv, cmds, _ := newTestAPI(t)
+	_, err := cmds.save("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := doRequest(t, srv, http.MethodGet, "/games", testToken, "")
+	expectStatus(t, resp, http.StatusOK)
+	var saves []gamelogic.WorldSave
+	decodeResponse(t, resp, &saves)
+	if len(saves) != 1 || saves[0].Name != "first" {
+		t.Errorf("games = %+v, want the one named first", saves)
+	}
+}
+
+func TestAPILogs(t *testing.T) {
+	srv, cmds, _ := newTestAPI(t)
+	now := time.Now()
+	for _, gl := range []routing.GameLog{
+		{CurrentTime: now, Username: "alice", Message: "alice attacks"},
+		{CurrentTime: now, Username: "bob", Message: "bob retreats"},
+	} {
+		err := cmds.logs.Write(gl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := doRequest(t, srv, http.MethodGet, "/logs?user=alice", testToken, "")
+	expectStatus(t, resp, http.StatusOK)
+	var gls []routing.GameLog
+	decodeResponse(t, resp, &gls)
+	if len(gls) != 1 || gls[0].Message != "alice attacks" {
+		t.Errorf("logs = %+v, want alice's only", gls)
+	}
+
+	resp = doRequest(t, srv, http.MethodGet, "/logs?limit=nope", testToken, "")
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	// Only the file sink can be queried
+	cmds.logsPath = ""
+	resp = doRequest(t, srv, http.MethodGet, "/logs", testToken, "")
+	expectStatus(t, resp, http.StatusNotFound)
+}
+
+func TestAPIKick(t *testing.T) {
+	srv, cmds, transport := newTestAPI(t)
+	cmds.world.AddPlayer("alice")
+
+	resp := doRequest(t, srv, http.MethodPost, "/players/alice/kick", testToken, `{"reason":"afk"}`)
+	expectStatus(t, resp, http.StatusNoContent)
+	if len(cmds.world.GetPlayersSnap()) != 0 {
+		t.Error("alice still in the game after being kicked")
+	}
+	if keys := transport.keys(); len(keys) != 1 || keys[0] != "admin.alice" {
+		t.Errorf("published %v, want admin.alice", keys)
+	}
+
+	resp = doRequest(t, srv, http.MethodPost, "/players/alice/kick", testToken, `{"reason":`)
+	expectStatus(t, resp, http.StatusBadRequest)
+}
+
+func TestAPIBans(t *testing.T) {
+	srv, cmds, transport := newTestAPI(t)
+	cmds.world.AddPlayer("alice")
+
+	resp := doRequest(t, srv, http.MethodPost, "/players/alice/ban", testToken, `{"duration":"1h","reason":"spam"}`)
+	expectStatus(t, resp, http.StatusNoContent)
+	if len(cmds.world.GetPlayersSnap()) != 0 {
+		t.Error("alice still in the game after being banned")
+	}
+	if keys := transport.keys(); len(keys) != 1 || keys[0] != "admin.alice" {
+		t.Errorf("published %v, want admin.alice", keys)
+	}
+
+	resp = doRequest(t, srv, http.MethodGet, "/bans", testToken, "")
+	expectStatus(t, resp, http.StatusOK)
+	var bans []moderation.Ban
+	decodeResponse(t, resp, &bans)
+	if len(bans) != 1 || bans[0].Username != "alice" || bans[0].Reason != "spam" || bans[0].Until.IsZero() {
+		t.Errorf("bans = %+v, want alice banned for an hour for spam", bans)
+	}
+
+	resp = doRequest(t, srv, http.MethodPost, "/players/bob/ban", testToken, `{"duration":"-1h"}`)
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = doRequest(t, srv, http.MethodDelete, "/bans/alice", testToken, "")
+	expectStatus(t, resp, http.StatusNoContent)
+	if _, ok := cmds.bans.IsBanned("alice", time.Now()); ok {
+		t.Error("alice still banned after DELETE /bans/alice")
+	}
+
+	resp = doRequest(t, srv, http.MethodDelete, "/bans/alice", testToken, "")
+	expectStatus(t, resp, http.StatusNotFound)
+}
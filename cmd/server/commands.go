@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/leaderboard"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/logsink"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/moderation"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// commands are the operations an operator can run on the server. The REPL
+// and the HTTP API both call them, so they behave the same either way.
+type commands struct {
+	transport pubsub.Transport
+	world     *gamelogic.World
+	treaties  *gamelogic.Treaties
+	events    *gamelogic.EventLog
+	logs      logsink.LogSink
+	logsPath  string // empty unless the file sink is enabled
+	bans      *moderation.Bans
+	moderator *moderation.Moderator
+	store     *leaderboard.Store
+}
+
+type playerStatus struct {
+	gamelogic.Standing
+	Balance int
+}
+
+func (c *commands) setPaused(paused bool) error {
+	c.world.SetPaused(paused)
+	state := routing.PlayingState{IsPaused: paused}
+	recordEvent(c.events, gamelogic.Event{Kind: gamelogic.EventPause, Pause: &state})
+	err := pubsub.PublishJSON(c.transport, routing.ExchangePerilDirect, routing.PauseKey, state)
+	if err != nil {
+		return fmt.Errorf("Failed to publish pause: %v", err)
+	}
+	return nil
+}
+
+func (c *commands) players() []playerStatus {
+	players := []playerStatus{}
+	for _, s := range c.world.GetStandings() {
+		players = append(players, playerStatus{
+			Standing: s,
+			Balance:  c.world.GetBalance(s.Username),
+		})
+	}
+	return players
+}
+
+func (c *commands) games() ([]gamelogic.WorldSave, error) {
+	return gamelogic.ListWorldSaves(savesDir)
+}
+
+func (c *commands) save(name string) (string, error) {
+	path, err := gamelogic.WorldSavePath(savesDir, name)
+	if err != nil {
+		return "", err
+	}
+	err = gamelogic.SaveWorld(path, c.world.GetSnapshot(c.treaties))
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (c *commands) load(name string) (gamelogic.WorldSnapshot, error) {
+	path, err := gamelogic.WorldSavePath(savesDir, name)
+	if err != nil {
+		return gamelogic.WorldSnapshot{}, err
+	}
+	ws, err := gamelogic.LoadWorld(path)
+	if err != nil {
+		return gamelogic.WorldSnapshot{}, err
+	}
+	c.world.Restore(ws, c.treaties)
+	err = broadcastRestore(c.transport, c.world, c.treaties, ws)
+	if err != nil {
+		return gamelogic.WorldSnapshot{}, fmt.Errorf("could not broadcast restored game: %v", err)
+	}
+	return ws, nil
+}
+
+// errNoLogFile is returned when querying logs without the file sink, the
+// only one queries can read.
+var errNoLogFile = errors.New("logs can only be queried from the file sink, which is not enabled")
+
+// queryLogs flushes pending writes first so the newest logs are included.
+func (c *commands) queryLogs(filter logsink.Filter) ([]routing.GameLog, error) {
+	if c.logsPath == "" {
+		return nil, errNoLogFile
+	}
+	if filter.Limit == 0 {
+		filter.Limit = logsQueryLimit
+	}
+	err := c.logs.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("could not flush logs: %v", err)
+	}
+	return logsink.Query(c.logsPath, filter)
+}
+
+// kick removes a player from the game and tells their client to exit.
+func (c *commands) kick(username, reason string) error {
+	if reason == "" {
+		reason = "kicked by the server operator"
+	}
+	err := publishAdmin(c.transport, username, routing.AdminMessage{Kind: routing.AdminKicked, Message: reason})
+	if err != nil {
+		return err
+	}
+	c.world.RemovePlayer(username)
+	return nil
+}
+
+// ban records a ban, then removes the player if they are connected. A zero
+// duration bans them forever.
+func (c *commands) ban(username string, duration time.Duration, reason string) error {
+	if reason == "" {
+		reason = "banned by the server operator"
+	}
+	ban := moderation.Ban{Username: username, Reason: reason, Since: time.Now()}
+	if duration > 0 {
+		ban.Until = ban.Since.Add(duration)
+	}
+	err := c.bans.Ban(ban)
+	if err != nil {
+		return err
+	}
+	err = publishAdmin(c.transport, username, routing.AdminMessage{
+		Kind:    routing.AdminBanned,
+		Message: ban.Reason,
+		Until:   ban.Until,
+	})
+	if err != nil {
+		return err
+	}
+	c.world.RemovePlayer(username)
+	return nil
+}
+
+func (c *commands) unban(username string) (bool, error) {
+	return c.bans.Unban(username)
+}
+
+func (c *commands) listBans() []moderation.Ban {
+	return c.bans.List(time.Now())
+}
+
+// broadcast sends an announcement to every player in the game.
+func (c *commands) broadcast(message string) error {
+	for _, p := range c.world.GetPlayersSnap() {
+		err := publishAdmin(c.transport, p.Username, routing.AdminMessage{Kind: routing.AdminBroadcast, Message: message})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *commands) unmute(username string) {
+	c.moderator.Unmute(username)
+}
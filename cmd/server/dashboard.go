@@ -0,0 +1,190 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const (
+	// dashboardFlushInterval batches state updates, so a burst of changes
+	// is sent to browsers once.
+	dashboardFlushInterval = 500 * time.Millisecond
+	dashboardClientBuffer  = 32
+)
+
+//go:embed dashboard
+var dashboardAssets embed.FS
+
+type dashboardEvent struct {
+	Name string
+	Data any
+}
+
+type dashboardState struct {
+	Paused  bool
+	Regions map[gamelogic.Location]map[string]int
+}
+
+type dashboardWar struct {
+	Attacker string
+	Defender string
+}
+
+// dashboard pushes live game state to browsers over Server-Sent Events.
+type dashboard struct {
+	world   *gamelogic.World
+	clients map[chan dashboardEvent]struct{}
+	dirty   bool
+	mu      *sync.Mutex
+}
+
+// newDashboard shows the world as the server's handlers change it, so the
+// state it sends always includes the change that prompted it.
+func newDashboard(world *gamelogic.World) *dashboard {
+	d := &dashboard{
+		world:   world,
+		clients: map[chan dashboardEvent]struct{}{},
+		mu:      &sync.Mutex{},
+	}
+	world.OnChange(d.markDirty)
+	return d
+}
+
+// subscribe feeds the dashboard the wars and game logs players see. Its
+// queue is named by the broker, so every server can run a dashboard.
+func (d *dashboard) subscribe(transport pubsub.Transport) error {
+	err := pubsub.SubscribeJSON(
+		transport,
+		routing.ExchangePerilTopic,
+		"",
+		fmt.Sprintf("%s.*", routing.WarRecognitionsPrefix),
+		pubsub.Transient,
+		func(rw gamelogic.RecognitionOfWar) pubsub.AckType {
+			d.send(dashboardEvent{Name: "war", Data: dashboardWar{
+				Attacker: rw.Attacker.Username,
+				Defender: rw.Defender.Username,
+			}})
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to wars: %v", err)
+	}
+
+	err = pubsub.SubscribeStreamGob(
+		transport,
+		routing.ExchangePerilTopic,
+		routing.GameLogStream,
+		fmt.Sprintf("%s.*", routing.GameLogSlug),
+		pubsub.OffsetNext(),
+		func(gl routing.GameLog) pubsub.AckType {
+			d.send(dashboardEvent{Name: "log", Data: gl})
+			return pubsub.Ack
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to game logs: %v", err)
+	}
+
+	return nil
+}
+
+func (d *dashboard) run() {
+	for range time.Tick(dashboardFlushInterval) {
+		d.mu.Lock()
+		dirty := d.dirty
+		d.dirty = false
+		d.mu.Unlock()
+		if dirty {
+			d.send(d.state())
+		}
+	}
+}
+
+func (d *dashboard) markDirty() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dirty = true
+}
+
+func (d *dashboard) state() dashboardEvent {
+	return dashboardEvent{Name: "state", Data: dashboardState{
+		Paused:  d.world.IsPaused(),
+		Regions: d.world.GetRegions(),
+	}}
+}
+
+// send drops events for browsers that are too slow to keep up rather than
+// holding up the rest.
+func (d *dashboard) send(e dashboardEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for c := range d.clients {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
+
+func (d *dashboard) handler() http.Handler {
+	assets, err := fs.Sub(dashboardAssets, "dashboard")
+	if err != nil {
+		log.Fatalf("Failed to load dashboard assets: %v\n", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(assets))
+	mux.HandleFunc("GET /events", d.serveEvents)
+	return mux
+}
+
+func (d *dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	c := make(chan dashboardEvent, dashboardClientBuffer)
+	d.mu.Lock()
+	d.clients[c] = struct{}{}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, c)
+		d.mu.Unlock()
+	}()
+
+	e := d.state()
+	for {
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			log.Printf("Failed to encode dashboard event: %v\n", err)
+			return
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, data)
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case e = <-c:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	warsFought = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_wars_fought_total",
+		Help: "Wars resolved, by whether they ended in a draw.",
+	}, []string{"outcome"})
+
+	gamesOver = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "peril_games_over_total",
+		Help: "Games that ended in victory.",
+	})
+)
+
+// registerWorldMetrics exposes player counts, read from world whenever
+// they're scraped.
+func registerWorldMetrics(world *gamelogic.World) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "peril_players",
+		Help: "Players in the game, online or not.",
+	}, func() float64 {
+		return float64(len(world.GetStandings()))
+	})
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "peril_players_active",
+		Help: "Players currently online.",
+	}, func() float64 {
+		active := 0
+		for _, s := range world.GetStandings() {
+			if s.Online {
+				active++
+			}
+		}
+		return float64(active)
+	})
+}
+
+func warOutcome(result gamelogic.WarResult) string {
+	if result.Draw {
+		return "draw"
+	}
+	return "win"
+}
@@ -0,0 +1,194 @@
+// Package config loads settings for the Peril binaries. Every setting is a
+// flag, and can also be set in a config file or an environment variable.
+// Each source overrides the one before it:
+//
+//  1. the flag's default
+//  2. the config file named by -config or PERIL_CONFIG
+//  3. PERIL_<NAME> environment variables, e.g. PERIL_BROKER_URL
+//  4. command-line flags
+//
+// Config files have one "name = value" setting per line, using the flag
+// names. Blank lines and lines starting with # are ignored.
+package config
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	configFlag      = "config"
+	printConfigFlag = "print-config"
+	envPrefix       = "PERIL_"
+	redacted        = "<redacted>"
+)
+
+// Parse parses args into fs, then layers the config file and environment
+// beneath them. It reports whether -print-config was given, in which case
+// the caller should Print the config and exit.
+func Parse(fs *flag.FlagSet, args []string) (bool, error) {
+	fs.String(configFlag, "", "file to read settings from, also set by "+envName(configFlag))
+	printConfig := fs.Bool(printConfigFlag, false, "print the effective config and exit")
+	err := fs.Parse(args)
+	if err != nil {
+		return false, err
+	}
+
+	set := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+
+	// Start over from the defaults so the file and environment go under
+	// the flags rather than over them
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		errs = append(errs, fs.Set(f.Name, f.DefValue))
+	})
+
+	path, ok := set[configFlag]
+	if !ok {
+		path = os.Getenv(envName(configFlag))
+	}
+	if path != "" {
+		errs = append(errs, readFile(fs, path))
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || f.Name == configFlag {
+			return
+		}
+		err := fs.Set(f.Name, v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s: %v", v, envName(f.Name), err))
+		}
+	})
+
+	for name, v := range set {
+		errs = append(errs, fs.Set(name, v))
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return false, err
+		}
+	}
+	return *printConfig, nil
+}
+
+func readFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open config file: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected name = value", path, n)
+		}
+		name = strings.TrimSpace(name)
+		if name == configFlag || name == printConfigFlag || fs.Lookup(name) == nil {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, n, name)
+		}
+		err := fs.Set(name, strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid value for %s: %v", path, n, name, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Print writes every setting in fs in the config file format. Passwords,
+// tokens and secrets are redacted.
+func Print(w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == configFlag || f.Name == printConfigFlag {
+			return
+		}
+		v := f.Value.String()
+		if secret(f.Name) && v != "" {
+			v = redacted
+		}
+		fmt.Fprintf(w, "# %s\n%s\n\n", f.Usage, strings.TrimSpace(f.Name+" = "+v))
+	})
+}
+
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func secret(name string) bool {
+	for _, s := range []string{"password", "token", "secret"} {
+		if strings.HasSuffix(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// listValue is a comma separated flag. Setting it replaces the list rather
+// than adding to it, so later sources override earlier ones.
+type listValue struct {
+	list *[]string
+}
+
+func (v listValue) String() string {
+	if v.list == nil {
+		return ""
+	}
+	return strings.Join(*v.list, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.list = nil
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			*v.list = append(*v.list, item)
+		}
+	}
+	return nil
+}
+
+// durationValue is a duration flag that rejects negative durations, and
+// zero unless it turns the setting off. Durations that drive a ticker can't
+// be zero, since time.NewTicker panics on it.
+type durationValue struct {
+	d         *time.Duration
+	allowZero bool
+}
+
+func (v durationValue) String() string {
+	if v.d == nil {
+		return time.Duration(0).String()
+	}
+	return v.d.String()
+}
+
+func (v durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("%v is negative", d)
+	}
+	if d == 0 && !v.allowZero {
+		return fmt.Errorf("%v is not positive", d)
+	}
+	*v.d = d
+	return nil
+}
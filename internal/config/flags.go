@@ -0,0 +1,71 @@
+package config
+
+import (
+	"flag"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+)
+
+// Server is the server's config.
+type Server struct {
+	Broker         pubsub.DialOptions
+	QueueType      string
+	Logs           Logs
+	Victory        gamelogic.VictoryConditions
+	IncomeInterval time.Duration
+	AdminAddr      string
+	AdminToken     string
+	DashboardAddr  string
+	MetricsAddr    string
+}
+
+// Logs configures where the server writes game logs.
+type Logs struct {
+	Sinks      []string
+	Path       string
+	SQLitePath string
+	WebhookURL string
+	Latency    time.Duration
+}
+
+// RegisterBroker adds the flags every binary connects to the broker with.
+func RegisterBroker(fs *flag.FlagSet, opts *pubsub.DialOptions) {
+	fs.StringVar(&opts.Transport, "transport", "amqp", "message broker to use: amqp, nats or stomp")
+	fs.Var(listValue{&opts.URLs}, "broker-url", "comma separated URLs of the broker's nodes, empty for the transport's default")
+	fs.StringVar(&opts.Failover, "broker-failover", pubsub.FailoverRoundRobin, "order to try the broker's nodes in: round-robin or random")
+	fs.StringVar(&opts.VHost, "broker-vhost", "", "AMQP or STOMP virtual host, empty to use the one in the URL")
+	fs.StringVar(&opts.Username, "broker-username", "", "user to log in to the broker as, empty to use the one in the URL")
+	fs.StringVar(&opts.Password, "broker-password", "", "password to log in to the broker with")
+	fs.StringVar(&opts.Auth, "broker-auth", pubsub.AuthPlain, "how to log in to the broker: plain, or external to use the TLS client certificate")
+	fs.StringVar(&opts.TLS.CAFile, "broker-tls-ca", "", "PEM bundle of CAs to verify the broker with, empty for the system's")
+	fs.StringVar(&opts.TLS.CertFile, "broker-tls-cert", "", "PEM client certificate to present to the broker")
+	fs.StringVar(&opts.TLS.KeyFile, "broker-tls-key", "", "PEM key of the client certificate")
+	fs.StringVar(&opts.TLS.ServerName, "broker-tls-server-name", "", "name to verify the broker's certificate against, empty for the URL's host")
+	fs.IntVar(&opts.Prefetch, "prefetch", pubsub.DefaultPrefetch, "deliveries each subscription may hold unacknowledged")
+	fs.IntVar(&opts.Workers, "workers", pubsub.DefaultWorkers, "goroutines handling each subscription's deliveries")
+}
+
+func (c *Server) Register(fs *flag.FlagSet) {
+	RegisterBroker(fs, &c.Broker)
+	fs.StringVar(&c.QueueType, "queue-type", "durable", "type of the server's shared queues: durable or quorum")
+
+	c.Logs.Sinks = []string{"file"}
+	fs.Var(listValue{&c.Logs.Sinks}, "log-sinks", "comma separated game log sinks: file, sqlite, stdout, webhook")
+	fs.StringVar(&c.Logs.Path, "log-path", "game_log.jsonl", "file for the file log sink")
+	fs.StringVar(&c.Logs.SQLitePath, "log-sqlite", "game_logs.db", "database for the sqlite log sink")
+	fs.StringVar(&c.Logs.WebhookURL, "log-webhook-url", "", "URL the webhook log sink posts to")
+	fs.Var(durationValue{&c.Logs.Latency, true}, "log-latency", "simulated latency before each game log write")
+
+	fs.IntVar(&c.Victory.Regions, "victory-regions", 4, "regions a player must hold without any opponent's units to win, 0 to disable")
+	fs.BoolVar(&c.Victory.Elimination, "victory-elimination", true, "end the game when only one player has units left")
+	fs.Var(durationValue{&c.Victory.TimeLimit, true}, "time-limit", "end the game after this long and rank players by score, 0 to disable")
+	c.IncomeInterval = 30 * time.Second
+	fs.Var(durationValue{&c.IncomeInterval, false}, "income-interval", "how often players are paid income")
+
+	fs.StringVar(&c.AdminAddr, "admin-addr", "", "address to serve the HTTP admin API on, empty to disable")
+	fs.StringVar(&c.AdminToken, "admin-token", "", "bearer token the HTTP admin API requires")
+	fs.StringVar(&c.DashboardAddr, "dashboard-addr", "", "address to serve the web dashboard on, empty to disable")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", "", "address to serve Prometheus metrics on at /metrics, empty to disable")
+}
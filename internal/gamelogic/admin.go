@@ -0,0 +1,40 @@
+package gamelogic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// HandleAdmin shows a message from the server operator, reporting whether
+// the player has been removed from the game.
+func (gs *GameState) HandleAdmin(msg routing.AdminMessage) bool {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+
+	switch msg.Kind {
+	case routing.AdminKicked:
+		fmt.Println("==== Kicked ====")
+		fmt.Printf("You have been kicked from the game: %s\n", msg.Message)
+		return true
+
+	case routing.AdminBanned:
+		fmt.Println("==== Banned ====")
+		if msg.Until.IsZero() {
+			fmt.Printf("You have been banned: %s\n", msg.Message)
+		} else {
+			fmt.Printf("You have been banned until %v: %s\n", msg.Until.Format(time.RFC3339), msg.Message)
+		}
+		return true
+
+	case routing.AdminBroadcast:
+		fmt.Println("==== Server Announcement ====")
+		fmt.Println(msg.Message)
+		return false
+
+	default:
+		fmt.Printf("Unknown message from the server: %s\n", msg.Kind)
+		return false
+	}
+}
@@ -0,0 +1,132 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const maxChatLength = 280
+
+func (gs *GameState) CommandSay(words []string) (routing.ChatMessage, error) {
+	if len(words) < 2 {
+		return routing.ChatMessage{}, errors.New("usage: say <message>")
+	}
+	return gs.newChat(routing.ChatGlobal, "", words[1:]), nil
+}
+
+func (gs *GameState) CommandWhisper(words []string) (routing.ChatMessage, error) {
+	if len(words) < 3 {
+		return routing.ChatMessage{}, errors.New("usage: whisper <username> <message>")
+	}
+	return gs.newChat(routing.ChatDirect, words[1], words[2:]), nil
+}
+
+func (gs *GameState) CommandTeam(words []string) (routing.ChatMessage, error) {
+	if len(words) < 2 {
+		return routing.ChatMessage{}, errors.New("usage: team <message>")
+	}
+	team := gs.GetTeam()
+	if team == "" {
+		return routing.ChatMessage{}, errors.New("error: you are not on a team, use join-team <id>")
+	}
+	return gs.newChat(routing.ChatTeam, team, words[1:]), nil
+}
+
+// CommandJoinTeam picks a team for the rest of the game. Players can not
+// switch, since they would keep receiving their old team's messages.
+func (gs *GameState) CommandJoinTeam(words []string) error {
+	defer gs.changed()
+	if len(words) < 2 {
+		return errors.New("usage: join-team <id>")
+	}
+	if strings.ContainsAny(words[1], ".*#") {
+		return fmt.Errorf("error: %s is not a valid team", words[1])
+	}
+	gs.mu.Lock()
+	if gs.team != "" {
+		team := gs.team
+		gs.mu.Unlock()
+		return fmt.Errorf("error: you are already on team %s", team)
+	}
+	gs.team = words[1]
+	gs.mu.Unlock()
+
+	fmt.Printf("Joined team %s\n", words[1])
+	return nil
+}
+
+func (gs *GameState) GetTeam() string {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.team
+}
+
+func (gs *GameState) HandleChat(msg routing.ChatMessage) {
+	switch msg.Channel {
+	case routing.ChatGlobal:
+		fmt.Printf("\n[global] %s: %s\n", msg.Username, msg.Message)
+	case routing.ChatDirect:
+		fmt.Printf("\n[whisper] %s: %s\n", msg.Username, msg.Message)
+	case routing.ChatTeam:
+		if msg.Target != gs.GetTeam() {
+			return
+		}
+		fmt.Printf("\n[team %s] %s: %s\n", msg.Target, msg.Username, msg.Message)
+	}
+}
+
+func (gs *GameState) newChat(channel routing.ChatChannel, target string, words []string) routing.ChatMessage {
+	return routing.ChatMessage{
+		CurrentTime: time.Now(),
+		Username:    gs.GetUsername(),
+		Channel:     channel,
+		Target:      target,
+		Message:     strings.Join(words, " "),
+	}
+}
+
+var profanities = []string{
+	"damn",
+	"hell",
+	"crap",
+	"bastard",
+}
+
+// FilterChat validates a chat message before the server relays it, masking
+// any profanity.
+func FilterChat(msg routing.ChatMessage) (routing.ChatMessage, error) {
+	text := strings.TrimSpace(msg.Message)
+	if text == "" {
+		return routing.ChatMessage{}, errors.New("message is empty")
+	}
+	if len(text) > maxChatLength {
+		return routing.ChatMessage{}, fmt.Errorf("message is longer than %d characters", maxChatLength)
+	}
+
+	switch msg.Channel {
+	case routing.ChatGlobal:
+	case routing.ChatDirect, routing.ChatTeam:
+		if msg.Target == "" || strings.ContainsAny(msg.Target, ".*#") {
+			return routing.ChatMessage{}, fmt.Errorf("invalid %s target: %q", msg.Channel, msg.Target)
+		}
+	default:
+		return routing.ChatMessage{}, fmt.Errorf("unknown channel: %s", msg.Channel)
+	}
+
+	words := strings.Fields(text)
+	for i, word := range words {
+		trimmed := strings.ToLower(strings.Trim(word, ".,!?;:'\""))
+		for _, bad := range profanities {
+			if trimmed == bad {
+				words[i] = strings.Repeat("*", len(word))
+				break
+			}
+		}
+	}
+	msg.Message = strings.Join(words, " ")
+	return msg, nil
+}
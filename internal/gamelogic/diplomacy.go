@@ -0,0 +1,285 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type DiplomacyAction string
+
+const (
+	DiplomacyProposeAlliance DiplomacyAction = "propose_alliance"
+	DiplomacyAcceptAlliance  DiplomacyAction = "accept_alliance"
+	DiplomacyBreakAlliance   DiplomacyAction = "break_alliance"
+	DiplomacyDeclareWar      DiplomacyAction = "declare_war"
+)
+
+type Diplomacy struct {
+	Action DiplomacyAction
+	From   Player
+	To     string
+}
+
+func (gs *GameState) CommandProposeAlliance(words []string) (Diplomacy, error) {
+	defer gs.changed()
+	if len(words) < 2 {
+		return Diplomacy{}, errors.New("usage: propose-alliance <username>")
+	}
+	username := words[1]
+	if username == gs.GetUsername() {
+		return Diplomacy{}, errors.New("error: you can not ally with yourself")
+	}
+	if gs.IsAlly(username) {
+		return Diplomacy{}, fmt.Errorf("error: you are already allied with %s", username)
+	}
+
+	gs.mu.Lock()
+	gs.proposed[username] = struct{}{}
+	gs.mu.Unlock()
+
+	fmt.Printf("Proposed an alliance to %s\n", username)
+	return gs.newDiplomacy(DiplomacyProposeAlliance, username), nil
+}
+
+func (gs *GameState) CommandAccept(words []string) (Diplomacy, error) {
+	defer gs.changed()
+	gs.mu.Lock()
+	var username string
+	if len(words) >= 2 {
+		username = words[1]
+	} else if len(gs.proposals) == 1 {
+		for k := range gs.proposals {
+			username = k
+		}
+	}
+	if username == "" {
+		gs.mu.Unlock()
+		return Diplomacy{}, errors.New("usage: accept <username>")
+	}
+	proposer, ok := gs.proposals[username]
+	if !ok {
+		gs.mu.Unlock()
+		return Diplomacy{}, fmt.Errorf("error: %s has not proposed an alliance", username)
+	}
+	delete(gs.proposals, username)
+	gs.allies[username] = proposer
+	gs.mu.Unlock()
+
+	fmt.Printf("You are now allied with %s\n", username)
+	return gs.newDiplomacy(DiplomacyAcceptAlliance, username), nil
+}
+
+func (gs *GameState) CommandBreakAlliance(words []string) (Diplomacy, error) {
+	defer gs.changed()
+	if len(words) < 2 {
+		return Diplomacy{}, errors.New("usage: break-alliance <username>")
+	}
+	username := words[1]
+	if !gs.IsAlly(username) {
+		return Diplomacy{}, fmt.Errorf("error: you are not allied with %s", username)
+	}
+	gs.removeAlly(username)
+
+	fmt.Printf("Broke the alliance with %s\n", username)
+	return gs.newDiplomacy(DiplomacyBreakAlliance, username), nil
+}
+
+func (gs *GameState) CommandDeclareWar(words []string) (Diplomacy, error) {
+	defer gs.changed()
+	if len(words) < 2 {
+		return Diplomacy{}, errors.New("usage: declare-war <username>")
+	}
+	username := words[1]
+	if username == gs.GetUsername() {
+		return Diplomacy{}, errors.New("error: you can not declare war on yourself")
+	}
+	gs.removeAlly(username)
+
+	fmt.Printf("Declared war on %s\n", username)
+	return gs.newDiplomacy(DiplomacyDeclareWar, username), nil
+}
+
+func (gs *GameState) HandleDiplomacy(d Diplomacy) {
+	defer gs.changed()
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Diplomacy ====")
+
+	from := d.From.Username
+	switch d.Action {
+	case DiplomacyProposeAlliance:
+		gs.mu.Lock()
+		gs.proposals[from] = d.From
+		gs.mu.Unlock()
+		fmt.Printf("%s has proposed an alliance. Type 'accept %s' to accept.\n", from, from)
+
+	case DiplomacyAcceptAlliance:
+		gs.mu.Lock()
+		_, ok := gs.proposed[from]
+		if ok {
+			delete(gs.proposed, from)
+			gs.allies[from] = d.From
+		}
+		gs.mu.Unlock()
+		if !ok {
+			fmt.Printf("%s accepted an alliance you never proposed.\n", from)
+			return
+		}
+		fmt.Printf("%s has accepted your alliance!\n", from)
+
+	case DiplomacyBreakAlliance:
+		gs.removeAlly(from)
+		fmt.Printf("%s has broken your alliance.\n", from)
+
+	case DiplomacyDeclareWar:
+		gs.removeAlly(from)
+		fmt.Printf("%s has declared war on you!\n", from)
+
+	default:
+		fmt.Printf("Unknown diplomatic action from %s: %s\n", from, d.Action)
+	}
+}
+
+func (gs *GameState) IsAlly(username string) bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	_, ok := gs.allies[username]
+	return ok
+}
+
+func (gs *GameState) GetAlliesSnap() []Player {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	allies := []Player{}
+	for _, v := range gs.allies {
+		allies = append(allies, v)
+	}
+	return allies
+}
+
+// updateAlly merges the units in p into what we know of an ally.
+func (gs *GameState) updateAlly(p Player) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	ally, ok := gs.allies[p.Username]
+	if !ok {
+		return
+	}
+	units := map[int]Unit{}
+	for k, v := range ally.Units {
+		units[k] = v
+	}
+	for k, v := range p.Units {
+		units[k] = v
+	}
+	gs.allies[p.Username] = Player{Username: p.Username, Units: units}
+}
+
+func (gs *GameState) removeAlly(username string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	delete(gs.allies, username)
+	delete(gs.proposals, username)
+	delete(gs.proposed, username)
+}
+
+// newDiplomacy only shares our units when accepting an alliance, and so only
+// with the new ally. A proposal reveals nothing: the proposer's units reach
+// us in the server's next view once we accept.
+func (gs *GameState) newDiplomacy(action DiplomacyAction, to string) Diplomacy {
+	from := Player{Username: gs.GetUsername(), Units: map[int]Unit{}}
+	if action == DiplomacyAcceptAlliance {
+		from = gs.GetPlayerSnap()
+	}
+	return Diplomacy{
+		Action: action,
+		From:   from,
+		To:     to,
+	}
+}
+
+type Treaty struct {
+	Parties [2]string
+	Since   time.Time
+}
+
+// Treaties is the server's record of proposed and signed alliances.
+type Treaties struct {
+	signed    map[[2]string]Treaty
+	proposals map[[2]string]time.Time
+	mu        *sync.RWMutex
+}
+
+func NewTreaties() *Treaties {
+	return &Treaties{
+		signed:    map[[2]string]Treaty{},
+		proposals: map[[2]string]time.Time{},
+		mu:        &sync.RWMutex{},
+	}
+}
+
+// Record applies a diplomacy message and returns a line describing it for
+// the game log.
+func (t *Treaties) Record(d Diplomacy, at time.Time) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	from := d.From.Username
+	pair := treatyKey(from, d.To)
+	switch d.Action {
+	case DiplomacyProposeAlliance:
+		t.proposals[[2]string{from, d.To}] = at
+		return fmt.Sprintf("%s proposed an alliance to %s", from, d.To)
+
+	case DiplomacyAcceptAlliance:
+		if _, ok := t.proposals[[2]string{d.To, from}]; !ok {
+			return fmt.Sprintf("%s accepted an alliance %s never proposed", from, d.To)
+		}
+		delete(t.proposals, [2]string{d.To, from})
+		t.signed[pair] = Treaty{Parties: pair, Since: at}
+		return fmt.Sprintf("%s and %s signed an alliance", d.To, from)
+
+	case DiplomacyBreakAlliance:
+		delete(t.signed, pair)
+		return fmt.Sprintf("%s broke the alliance with %s", from, d.To)
+
+	case DiplomacyDeclareWar:
+		delete(t.signed, pair)
+		delete(t.proposals, [2]string{from, d.To})
+		delete(t.proposals, [2]string{d.To, from})
+		return fmt.Sprintf("%s declared war on %s", from, d.To)
+
+	default:
+		return fmt.Sprintf("%s sent an unknown diplomatic action to %s: %s", from, d.To, d.Action)
+	}
+}
+
+func (t *Treaties) IsAllied(a, b string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.signed[treatyKey(a, b)]
+	return ok
+}
+
+func (t *Treaties) GetTreatiesSnap() []Treaty {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	treaties := []Treaty{}
+	for _, v := range t.signed {
+		treaties = append(treaties, v)
+	}
+	sort.Slice(treaties, func(i, j int) bool {
+		return treaties[i].Since.Before(treaties[j].Since)
+	})
+	return treaties
+}
+
+func treatyKey(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
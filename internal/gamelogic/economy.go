@@ -0,0 +1,85 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	startingResources = 100
+	incomePerRegion   = 10
+)
+
+type Spawn struct {
+	Username string
+	Unit     Unit
+}
+
+type Income struct {
+	Username string
+	Amount   int
+	Regions  int
+	Balance  int
+}
+
+func getRankCosts() map[UnitRank]int {
+	return map[UnitRank]int{
+		RankInfantry:  10,
+		RankCavalry:   50,
+		RankArtillery: 100,
+	}
+}
+
+func RankCost(rank UnitRank) int {
+	return getRankCosts()[rank]
+}
+
+// describeRankCosts lists every rank with its cost, cheapest first.
+func describeRankCosts() string {
+	costs := getRankCosts()
+	ranks := []UnitRank{}
+	for rank := range costs {
+		ranks = append(ranks, rank)
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		return costs[ranks[i]] < costs[ranks[j]]
+	})
+
+	parts := []string{}
+	for _, rank := range ranks {
+		parts = append(parts, fmt.Sprintf("%s %d", rank, costs[rank]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (gs *GameState) GetResources() int {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.resources
+}
+
+// spend deducts cost from the treasury, reporting whether it could be paid.
+func (gs *GameState) spend(cost int) bool {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.resources < cost {
+		return false
+	}
+	gs.resources -= cost
+	return true
+}
+
+// HandleIncome syncs the treasury with the balance the server holds.
+func (gs *GameState) HandleIncome(inc Income) {
+	defer gs.changed()
+	gs.mu.Lock()
+	gs.resources = inc.Balance
+	gs.mu.Unlock()
+
+	if inc.Amount == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf("Collected %d resources from %d region(s). Treasury: %d\n", inc.Amount, inc.Regions, inc.Balance)
+}
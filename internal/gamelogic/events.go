@@ -0,0 +1,236 @@
+package gamelogic
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+type EventKind string
+
+const (
+	EventJoin   EventKind = "join"
+	EventLeave  EventKind = "leave"
+	EventSpawn  EventKind = "spawn"
+	EventMove   EventKind = "move"
+	EventWar    EventKind = "war"
+	EventPause  EventKind = "pause"
+	EventIncome EventKind = "income"
+)
+
+// Event is a single state change. Exactly one of the payload fields is set,
+// matching Kind.
+type Event struct {
+	Seq      int
+	Time     time.Time
+	Kind     EventKind
+	Username string
+
+	Spawn  *Spawn                `json:",omitempty"`
+	Move   *ArmyMove             `json:",omitempty"`
+	War    *WarResult            `json:",omitempty"`
+	Pause  *routing.PlayingState `json:",omitempty"`
+	Income *Income               `json:",omitempty"`
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventJoin:
+		return fmt.Sprintf("%s joined the game", e.Username)
+	case EventLeave:
+		return fmt.Sprintf("%s left the game", e.Username)
+	case EventSpawn:
+		return fmt.Sprintf("%s spawned a(n) %s in %s with id %v", e.Username, e.Spawn.Unit.Rank, e.Spawn.Unit.Location, e.Spawn.Unit.ID)
+	case EventMove:
+		return fmt.Sprintf("%s moved %v unit(s) to %s", e.Username, len(e.Move.Units), e.Move.ToLocation)
+	case EventWar:
+		if e.War.Draw {
+			return fmt.Sprintf("%s and %s fought to a draw in %s, casualties %v", e.War.Attacker, e.War.Defender, e.War.Location, e.War.Casualties)
+		}
+		return fmt.Sprintf("%s beat %s in %s, casualties %v", e.War.Winner, e.War.Loser, e.War.Location, e.War.Casualties)
+	case EventPause:
+		if e.Pause.IsPaused {
+			return "the game was paused"
+		}
+		return "the game was resumed"
+	case EventIncome:
+		return fmt.Sprintf("%s collected %d resources, treasury %d", e.Username, e.Income.Amount, e.Income.Balance)
+	default:
+		return fmt.Sprintf("unknown event %s", e.Kind)
+	}
+}
+
+// EventLog is an append-only JSON Lines file of events.
+type EventLog struct {
+	f      *os.File
+	seq    int
+	closed bool
+	mu     *sync.Mutex
+}
+
+func OpenEventLog(path string) (*EventLog, error) {
+	events, err := ReadEvents(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open event log: %v", err)
+	}
+
+	seq := 0
+	if len(events) > 0 {
+		seq = events[len(events)-1].Seq
+	}
+	return &EventLog{f: f, seq: seq, mu: &sync.Mutex{}}, nil
+}
+
+func (l *EventLog) Append(e Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errors.New("event log is closed")
+	}
+
+	l.seq++
+	e.Seq = l.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("could not encode event: %v", err)
+	}
+	_, err = l.f.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("could not write event: %v", err)
+	}
+	return nil
+}
+
+func (l *EventLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return l.f.Close()
+}
+
+func ReadEvents(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := []Event{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e Event
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode event %d: %v", len(events)+1, err)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read event log: %v", err)
+	}
+	return events, nil
+}
+
+// Rebuild folds events into a fresh GameState for username.
+func Rebuild(username string, events []Event) *GameState {
+	gs := NewGameState(username)
+	for _, e := range events {
+		Reduce(gs, e)
+	}
+	return gs
+}
+
+// Reduce applies a single event to gs. It has no side effects beyond gs, so
+// replaying the same events always produces the same state.
+func Reduce(gs *GameState, e Event) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	username := gs.Player.Username
+	switch e.Kind {
+	case EventJoin:
+		if e.Username == username && len(gs.Player.Units) == 0 && gs.turn == 0 {
+			gs.resources = startingResources
+		}
+
+	case EventSpawn:
+		if e.Username != username {
+			return
+		}
+		gs.Player.Units[e.Spawn.Unit.ID] = e.Spawn.Unit
+		gs.nextUnitID = max(gs.nextUnitID, e.Spawn.Unit.ID+1)
+		gs.resources -= RankCost(e.Spawn.Unit.Rank)
+
+	case EventMove:
+		if e.Username != username {
+			return
+		}
+		for _, unit := range e.Move.Units {
+			gs.Player.Units[unit.ID] = unit
+		}
+		gs.turn++
+
+	case EventWar:
+		if _, ok := e.War.Casualties[username]; ok {
+			for k, v := range gs.Player.Units {
+				if v.Location == e.War.Location {
+					delete(gs.Player.Units, k)
+				}
+			}
+		}
+		for _, eliminated := range e.War.Eliminated {
+			if eliminated == username {
+				gs.eliminated = true
+			}
+		}
+
+	case EventPause:
+		gs.Paused = e.Pause.IsPaused
+
+	case EventIncome:
+		if e.Username == username {
+			gs.resources = e.Income.Balance
+		}
+	}
+}
+
+// Replay prints every event in the log along with username's state after
+// each one that affects them. Gaps between events are divided by speed; a
+// speed of 0 replays without waiting.
+func Replay(events []Event, username string, speed float64, maxDelay time.Duration) *GameState {
+	gs := NewGameState(username)
+	for i, e := range events {
+		if speed > 0 && i > 0 {
+			delay := time.Duration(float64(e.Time.Sub(events[i-1].Time)) / speed)
+			time.Sleep(max(0, min(delay, maxDelay)))
+		}
+
+		fmt.Printf("#%d %v %s\n", e.Seq, e.Time.Format(time.RFC3339), e)
+		before := len(gs.getUnitsSnap())
+		Reduce(gs, e)
+		if e.Username == username || len(gs.getUnitsSnap()) != before {
+			p := gs.GetPlayerSnap()
+			fmt.Printf("  %s: %d unit(s), %d resources\n", username, len(p.Units), gs.GetResources())
+			for _, unit := range p.Units {
+				fmt.Printf("  * %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+			}
+		}
+	}
+	return gs
+}
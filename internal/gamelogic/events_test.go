@@ -0,0 +1,260 @@
+package gamelogic
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func spawnEvent(username string, id int, rank UnitRank, loc Location) Event {
+	return Event{
+		Kind:     EventSpawn,
+		Username: username,
+		Spawn:    &Spawn{Username: username, Unit: Unit{ID: id, Rank: rank, Location: loc}},
+	}
+}
+
+func moveEvent(username string, loc Location, units ...Unit) Event {
+	return Event{
+		Kind:     EventMove,
+		Username: username,
+		Move:     &ArmyMove{Player: Player{Username: username}, Units: units, ToLocation: loc},
+	}
+}
+
+func warEvent(result WarResult) Event {
+	return Event{Kind: EventWar, Username: result.Attacker, War: &result}
+}
+
+func TestReduce(t *testing.T) {
+	tests := []struct {
+		name       string
+		events     []Event
+		units      map[int]Unit
+		resources  int
+		turn       int
+		paused     bool
+		eliminated bool
+	}{
+		{
+			name:      "join",
+			events:    []Event{{Kind: EventJoin, Username: "alice"}},
+			units:     map[int]Unit{},
+			resources: startingResources,
+		},
+		{
+			name: "spawn charges for the unit",
+			events: []Event{
+				{Kind: EventJoin, Username: "alice"},
+				spawnEvent("alice", 1, RankCavalry, "europe"),
+			},
+			units:     map[int]Unit{1: {1, RankCavalry, "europe"}},
+			resources: startingResources - RankCost(RankCavalry),
+		},
+		{
+			name: "other players' spawns are ignored",
+			events: []Event{
+				{Kind: EventJoin, Username: "alice"},
+				spawnEvent("bob", 1, RankInfantry, "asia"),
+			},
+			units:     map[int]Unit{},
+			resources: startingResources,
+		},
+		{
+			name: "move",
+			events: []Event{
+				spawnEvent("alice", 1, RankInfantry, "europe"),
+				spawnEvent("alice", 2, RankInfantry, "europe"),
+				moveEvent("alice", "asia", Unit{1, RankInfantry, "asia"}),
+			},
+			units: map[int]Unit{
+				1: {1, RankInfantry, "asia"},
+				2: {2, RankInfantry, "europe"},
+			},
+			resources: startingResources - 2*RankCost(RankInfantry),
+			turn:      1,
+		},
+		{
+			name: "casualties only remove units in the war's location",
+			events: []Event{
+				spawnEvent("alice", 1, RankInfantry, "europe"),
+				spawnEvent("alice", 2, RankInfantry, "asia"),
+				warEvent(WarResult{
+					Attacker:   "bob",
+					Defender:   "alice",
+					Winner:     "bob",
+					Loser:      "alice",
+					Location:   "europe",
+					Casualties: map[string]int{"alice": 1},
+				}),
+			},
+			units:     map[int]Unit{2: {2, RankInfantry, "asia"}},
+			resources: startingResources - 2*RankCost(RankInfantry),
+		},
+		{
+			name: "wars we lost nothing in are ignored",
+			events: []Event{
+				spawnEvent("alice", 1, RankInfantry, "europe"),
+				warEvent(WarResult{
+					Attacker:   "bob",
+					Defender:   "carol",
+					Winner:     "bob",
+					Loser:      "carol",
+					Location:   "europe",
+					Casualties: map[string]int{"carol": 1},
+				}),
+			},
+			units:     map[int]Unit{1: {1, RankInfantry, "europe"}},
+			resources: startingResources - RankCost(RankInfantry),
+		},
+		{
+			name: "elimination",
+			events: []Event{
+				spawnEvent("alice", 1, RankInfantry, "europe"),
+				warEvent(WarResult{
+					Attacker:   "alice",
+					Defender:   "bob",
+					Winner:     "bob",
+					Loser:      "alice",
+					Location:   "europe",
+					Casualties: map[string]int{"alice": 1},
+					Eliminated: []string{"alice"},
+				}),
+			},
+			units:      map[int]Unit{},
+			resources:  startingResources - RankCost(RankInfantry),
+			eliminated: true,
+		},
+		{
+			name: "pause and resume",
+			events: []Event{
+				{Kind: EventPause, Pause: &routing.PlayingState{IsPaused: true}},
+				{Kind: EventPause, Pause: &routing.PlayingState{IsPaused: false}},
+				{Kind: EventPause, Pause: &routing.PlayingState{IsPaused: true}},
+			},
+			units:     map[int]Unit{},
+			resources: startingResources,
+			paused:    true,
+		},
+		{
+			name: "income sets the treasury",
+			events: []Event{
+				spawnEvent("alice", 1, RankArtillery, "europe"),
+				{Kind: EventIncome, Username: "alice", Income: &Income{Username: "alice", Amount: 10, Balance: 10}},
+				{Kind: EventIncome, Username: "bob", Income: &Income{Username: "bob", Amount: 10, Balance: 500}},
+			},
+			units:     map[int]Unit{1: {1, RankArtillery, "europe"}},
+			resources: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewGameState("alice")
+			for _, e := range tt.events {
+				Reduce(gs, e)
+			}
+
+			p := gs.GetPlayerSnap()
+			if len(p.Units) != len(tt.units) {
+				t.Errorf("units = %v, want %v", p.Units, tt.units)
+			}
+			for id, want := range tt.units {
+				if got := p.Units[id]; got != want {
+					t.Errorf("unit %d = %v, want %v", id, got, want)
+				}
+			}
+			if got := gs.GetResources(); got != tt.resources {
+				t.Errorf("resources = %d, want %d", got, tt.resources)
+			}
+			if gs.turn != tt.turn {
+				t.Errorf("turn = %d, want %d", gs.turn, tt.turn)
+			}
+			if gs.isPaused() != tt.paused {
+				t.Errorf("paused = %v, want %v", gs.isPaused(), tt.paused)
+			}
+			if gs.IsEliminated() != tt.eliminated {
+				t.Errorf("eliminated = %v, want %v", gs.IsEliminated(), tt.eliminated)
+			}
+		})
+	}
+}
+
+func TestRebuildFromEventLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l, err := OpenEventLog(path)
+	if err != nil {
+		t.Fatalf("OpenEventLog: %v", err)
+	}
+	for _, e := range []Event{
+		{Kind: EventJoin, Username: "alice"},
+		{Kind: EventJoin, Username: "bob"},
+		spawnEvent("alice", 1, RankInfantry, "europe"),
+		spawnEvent("alice", 2, RankCavalry, "asia"),
+		spawnEvent("bob", 1, RankArtillery, "europe"),
+		moveEvent("bob", "europe", Unit{1, RankArtillery, "europe"}),
+		warEvent(WarResult{
+			Attacker:   "bob",
+			Defender:   "alice",
+			Winner:     "bob",
+			Loser:      "alice",
+			Location:   "europe",
+			Casualties: map[string]int{"alice": 1},
+		}),
+		moveEvent("alice", "africa", Unit{2, RankCavalry, "africa"}),
+	} {
+		err = l.Append(e)
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	err = l.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	events, err := ReadEvents(path)
+	if err != nil {
+		t.Fatalf("ReadEvents: %v", err)
+	}
+	for i, e := range events {
+		if e.Seq != i+1 {
+			t.Errorf("event %d has seq %d", i+1, e.Seq)
+		}
+	}
+
+	gs := Rebuild("alice", events)
+	units := gs.GetPlayerSnap().Units
+	if len(units) != 1 || units[2] != (Unit{2, RankCavalry, "africa"}) {
+		t.Errorf("units = %v, want only the cavalry in africa", units)
+	}
+	want := startingResources - RankCost(RankInfantry) - RankCost(RankCavalry)
+	if got := gs.GetResources(); got != want {
+		t.Errorf("resources = %d, want %d", got, want)
+	}
+	if gs.turn != 1 {
+		t.Errorf("turn = %d, want 1", gs.turn)
+	}
+	// Rebuilt players never reuse the IDs of units they spawned
+	if id := gs.newUnitID(); id != 3 {
+		t.Errorf("next unit id = %d, want 3", id)
+	}
+
+	// Reopening carries on numbering where the log left off
+	l, err = OpenEventLog(path)
+	if err != nil {
+		t.Fatalf("OpenEventLog: %v", err)
+	}
+	defer l.Close()
+	err = l.Append(Event{Kind: EventLeave, Username: "bob"})
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	events, err = ReadEvents(path)
+	if err != nil {
+		t.Fatalf("ReadEvents: %v", err)
+	}
+	if last := events[len(events)-1]; last.Seq != len(events) {
+		t.Errorf("appended event has seq %d, want %d", last.Seq, len(events))
+	}
+}
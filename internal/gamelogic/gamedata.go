@@ -19,6 +19,8 @@ type Unit struct {
 	Location Location
 }
 
+// ArmyMove carries only the units that moved; Player.Units holds the same
+// units so opponents never learn the rest of the mover's army.
 type ArmyMove struct {
 	Player     Player
 	Units      []Unit
@@ -26,8 +28,9 @@ type ArmyMove struct {
 }
 
 type RecognitionOfWar struct {
-	Attacker Player
-	Defender Player
+	Attacker       Player
+	Defender       Player
+	DefenderAllies []Player
 }
 
 type Location string
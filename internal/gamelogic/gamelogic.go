@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"sort"
 	"strings"
 )
 
@@ -17,7 +18,18 @@ func PrintClientHelp() {
 	fmt.Println("* spawn <location> <rank>")
 	fmt.Println("    example:")
 	fmt.Println("    spawn europe infantry")
+	fmt.Printf("    costs: %s\n", describeRankCosts())
 	fmt.Println("* status")
+	fmt.Println("* propose-alliance <username>")
+	fmt.Println("* accept [username]")
+	fmt.Println("* break-alliance <username>")
+	fmt.Println("* declare-war <username>")
+	fmt.Println("* say <message>")
+	fmt.Println("* whisper <username> <message>")
+	fmt.Println("* join-team <id>")
+	fmt.Println("* team <message>")
+	fmt.Println("* leaderboard")
+	fmt.Println("* history [username]")
 	fmt.Println("* spam <n>")
 	fmt.Println("    example:")
 	fmt.Println("    spam 5")
@@ -42,10 +54,27 @@ func PrintServerHelp() {
 	fmt.Println("Possible commands:")
 	fmt.Println("* pause")
 	fmt.Println("* resume")
+	fmt.Println("* players")
+	fmt.Println("* games")
+	fmt.Println("* treaties")
+	fmt.Println("* leaderboard")
+	fmt.Println("* history <username>")
+	fmt.Println("* save <name>")
+	fmt.Println("* load <name>")
+	fmt.Println("* replay <username> [speed]")
+	fmt.Println("* logs [user=<username>] [since=<time>] [until=<time>] [text=<text>] [limit=<n>]")
+	fmt.Println("* unmute <username>")
+	fmt.Println("* kick <username> [reason]")
+	fmt.Println("* ban <username> [duration] [reason]")
+	fmt.Println("* unban <username>")
+	fmt.Println("* bans")
+	fmt.Println("* broadcast <message>")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
 
+// GetInput reads a line of words from stdin. It returns nil once stdin has
+// been closed, and an empty slice for a blank line.
 func GetInput() []string {
 	fmt.Print("> ")
 	scanner := bufio.NewScanner(os.Stdin)
@@ -76,17 +105,46 @@ func PrintQuit() {
 	fmt.Println("I hate this game! (╯°□°)╯︵ ┻━┻")
 }
 
+// Status is everything the status command shows, for clients that render
+// it themselves.
+type Status struct {
+	Username  string
+	Paused    bool
+	Resources int
+	Turn      int
+	Units     []Unit
+	Visible   []Player
+}
+
+func (gs *GameState) GetStatus() Status {
+	units := gs.getUnitsSnap()
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].ID < units[j].ID
+	})
+	return Status{
+		Username:  gs.GetUsername(),
+		Paused:    gs.isPaused(),
+		Resources: gs.GetResources(),
+		Turn:      gs.GetTurn(),
+		Units:     units,
+		Visible:   gs.getVisibleSnap(),
+	}
+}
+
 func (gs *GameState) CommandStatus() {
-	if gs.isPaused() {
+	s := gs.GetStatus()
+	if s.Paused {
 		fmt.Println("The game is paused.")
 		return
 	} else {
 		fmt.Println("The game is not paused.")
 	}
 
-	p := gs.GetPlayerSnap()
-	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
-	for _, unit := range p.Units {
+	fmt.Printf("You are %s, and you have %d units.\n", s.Username, len(s.Units))
+	fmt.Printf("Your treasury holds %d resources.\n", s.Resources)
+	fmt.Printf("You have taken %d turn(s).\n", s.Turn)
+	for _, unit := range s.Units {
 		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
 	}
+	printVisible(s.Visible)
 }
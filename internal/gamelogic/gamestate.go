@@ -8,6 +8,19 @@ type GameState struct {
 	Player Player
 	Paused bool
 	mu     *sync.RWMutex
+
+	allies     map[string]Player
+	proposals  map[string]Player
+	proposed   map[string]struct{}
+	team       string
+	resources  int
+	eliminated bool
+	visible    map[string]Player
+	turn       int
+	nextUnitID int
+
+	autosavePath string
+	saveMu       *sync.Mutex
 }
 
 func NewGameState(username string) *GameState {
@@ -18,6 +31,15 @@ func NewGameState(username string) *GameState {
 		},
 		Paused: false,
 		mu:     &sync.RWMutex{},
+
+		allies:     map[string]Player{},
+		proposals:  map[string]Player{},
+		proposed:   map[string]struct{}{},
+		resources:  startingResources,
+		visible:    map[string]Player{},
+		nextUnitID: 1,
+
+		saveMu: &sync.Mutex{},
 	}
 }
 
@@ -39,20 +61,48 @@ func (gs *GameState) isPaused() bool {
 	return gs.Paused
 }
 
+// newUnitID hands out the ID for the next unit. It only ever goes up, so a
+// new unit never shares an ID with one that is still in play.
+func (gs *GameState) newUnitID() int {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	id := gs.nextUnitID
+	gs.nextUnitID++
+	return id
+}
+
 func (gs *GameState) addUnit(u Unit) {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 	gs.Player.Units[u.ID] = u
+	if u.ID >= gs.nextUnitID {
+		gs.nextUnitID = u.ID + 1
+	}
 }
 
-func (gs *GameState) removeUnitsInLocation(loc Location) {
+func (gs *GameState) removeUnitsInLocation(loc Location) int {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
+	removed := 0
 	for k, v := range gs.Player.Units {
 		if v.Location == loc {
 			delete(gs.Player.Units, k)
+			removed++
 		}
 	}
+	return removed
+}
+
+func (gs *GameState) eliminate() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.eliminated = true
+}
+
+func (gs *GameState) IsEliminated() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.eliminated
 }
 
 func (gs *GameState) UpdateUnit(u Unit) {
@@ -61,6 +111,12 @@ func (gs *GameState) UpdateUnit(u Unit) {
 	gs.Player.Units[u.ID] = u
 }
 
+func (gs *GameState) GetTurn() int {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.turn
+}
+
 func (gs *GameState) GetUsername() string {
 	return gs.Player.Username
 }
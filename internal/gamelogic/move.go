@@ -20,15 +20,26 @@ func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
 
 	fmt.Println()
 	fmt.Println("==== Move Detected ====")
-	fmt.Printf("%s is moving %v unit(s) to %s\n", move.Player.Username, len(move.Units), move.ToLocation)
-	for _, unit := range move.Units {
-		fmt.Printf("* %v\n", unit.Rank)
-	}
-
 	if player.Username == move.Player.Username {
+		fmt.Printf("You moved %v unit(s) to %s\n", len(move.Units), move.ToLocation)
 		return MoveOutcomeSamePlayer
 	}
 
+	if gs.CanSeeMove(move) {
+		fmt.Printf("%s is moving %v unit(s) to %s\n", move.Player.Username, len(move.Units), move.ToLocation)
+		for _, unit := range move.Units {
+			fmt.Printf("* %v\n", unit.Rank)
+		}
+	} else {
+		fmt.Printf("%s moved units somewhere you can not see.\n", move.Player.Username)
+	}
+
+	if gs.IsAlly(move.Player.Username) {
+		gs.updateAlly(move.Player)
+		fmt.Printf("%s is your ally.\n", move.Player.Username)
+		return MoveOutComeSafe
+	}
+
 	overlappingLocation := getOverlappingLocation(player, move.Player)
 	if overlappingLocation != "" {
 		fmt.Printf("You have units in %s! You are at war with %s!\n", overlappingLocation, move.Player.Username)
@@ -50,9 +61,13 @@ func getOverlappingLocation(p1 Player, p2 Player) Location {
 }
 
 func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
+	defer gs.changed()
 	if gs.isPaused() {
 		return ArmyMove{}, errors.New("the game is paused, you can not move units")
 	}
+	if gs.IsEliminated() {
+		return ArmyMove{}, errors.New("you have been eliminated, you can not move units")
+	}
 	if len(words) < 3 {
 		return ArmyMove{}, errors.New("usage: move <location> <unitID> <unitID> <unitID> etc")
 	}
@@ -72,6 +87,7 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 	}
 
 	newUnits := []Unit{}
+	movedUnits := map[int]Unit{}
 	for _, unitID := range unitIDs {
 		unit, ok := gs.GetUnit(unitID)
 		if !ok {
@@ -80,13 +96,20 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 		unit.Location = newLocation
 		gs.UpdateUnit(unit)
 		newUnits = append(newUnits, unit)
+		movedUnits[unit.ID] = unit
 	}
 
 	mv := ArmyMove{
 		ToLocation: newLocation,
 		Units:      newUnits,
-		Player:     gs.GetPlayerSnap(),
+		Player: Player{
+			Username: gs.GetUsername(),
+			Units:    movedUnits,
+		},
 	}
+	gs.mu.Lock()
+	gs.turn++
+	gs.mu.Unlock()
 	fmt.Printf("Moved %v units to %s\n", len(mv.Units), mv.ToLocation)
 	return mv, nil
 }
@@ -7,6 +7,7 @@ import (
 )
 
 func (gs *GameState) HandlePause(ps routing.PlayingState) {
+	defer gs.changed()
 	defer fmt.Println("------------------------")
 	fmt.Println()
 	if ps.IsPaused {
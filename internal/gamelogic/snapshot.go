@@ -0,0 +1,219 @@
+package gamelogic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SnapshotVersion is bumped whenever Snapshot changes shape. Older files are
+// brought up to date by snapshotMigrations before being decoded.
+const SnapshotVersion = 1
+
+// snapshotMigrations upgrades a raw snapshot from the version it is keyed
+// by to the next one.
+var snapshotMigrations = map[int]func(map[string]any) error{}
+
+type Snapshot struct {
+	Version    int
+	Username   string
+	Units      map[int]Unit
+	Paused     bool
+	Turn       int
+	Resources  int
+	Eliminated bool
+	Allies     map[string]Player
+	Team       string
+	NextUnitID int
+}
+
+func SnapshotPath(username string) string {
+	return fmt.Sprintf("peril_%s.json", username)
+}
+
+func (gs *GameState) GetSnapshot() Snapshot {
+	p := gs.GetPlayerSnap()
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	allies := map[string]Player{}
+	for k, v := range gs.allies {
+		allies[k] = v
+	}
+	return Snapshot{
+		Version:    SnapshotVersion,
+		Username:   p.Username,
+		Units:      p.Units,
+		Paused:     gs.Paused,
+		Turn:       gs.turn,
+		Resources:  gs.resources,
+		Eliminated: gs.eliminated,
+		Allies:     allies,
+		Team:       gs.team,
+		NextUnitID: gs.nextUnitID,
+	}
+}
+
+func (gs *GameState) Restore(s Snapshot) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	units := map[int]Unit{}
+	// Saves from before NextUnitID was recorded start counting after the
+	// highest unit they hold
+	nextUnitID := max(gs.nextUnitID, s.NextUnitID)
+	for k, v := range s.Units {
+		units[k] = v
+		nextUnitID = max(nextUnitID, v.ID+1)
+	}
+	allies := map[string]Player{}
+	for k, v := range s.Allies {
+		allies[k] = v
+	}
+	gs.Player.Units = units
+	gs.Paused = s.Paused
+	gs.turn = s.Turn
+	gs.resources = s.Resources
+	gs.eliminated = s.Eliminated
+	gs.allies = allies
+	gs.team = s.Team
+	gs.nextUnitID = nextUnitID
+}
+
+// SaveSnapshot is safe to call from concurrent handlers. Saves run one at a
+// time, so the last one to finish always holds the latest state.
+func (gs *GameState) SaveSnapshot(path string) error {
+	gs.saveMu.Lock()
+	defer gs.saveMu.Unlock()
+
+	data, err := json.MarshalIndent(gs.GetSnapshot(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %v", err)
+	}
+
+	err = writeFileAtomic(path, data)
+	if err != nil {
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	return nil
+}
+
+func LoadSnapshot(path string) (Snapshot, error) {
+	var s Snapshot
+	err := loadVersioned(path, SnapshotVersion, snapshotMigrations, &s)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return s, nil
+}
+
+// loadVersioned decodes the JSON file at path into out, first running any
+// migrations needed to bring it from its stored version up to current.
+func loadVersioned(path string, current int, migrations map[int]func(map[string]any) error, out any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	raw := map[string]any{}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return fmt.Errorf("could not decode snapshot: %v", err)
+	}
+
+	version := 0
+	if v, ok := raw["Version"].(float64); ok {
+		version = int(v)
+	}
+	if version > current {
+		return fmt.Errorf("snapshot version %d is newer than supported version %d", version, current)
+	}
+	for ; version < current; version++ {
+		migrate, ok := migrations[version]
+		if !ok {
+			return fmt.Errorf("no migration from snapshot version %d", version)
+		}
+		err = migrate(raw)
+		if err != nil {
+			return fmt.Errorf("could not migrate snapshot from version %d: %v", version, err)
+		}
+	}
+	raw["Version"] = current
+
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("could not decode snapshot: %v", err)
+	}
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		return fmt.Errorf("could not decode snapshot: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file first so a crash never leaves
+// a torn file behind. Each write gets its own temporary file, so concurrent
+// writers can not interleave.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// EnableAutosave saves a snapshot to path every time the game state changes.
+func (gs *GameState) EnableAutosave(path string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.autosavePath = path
+}
+
+func (gs *GameState) changed() {
+	gs.mu.RLock()
+	path := gs.autosavePath
+	gs.mu.RUnlock()
+	if path == "" {
+		return
+	}
+
+	err := gs.SaveSnapshot(path)
+	if err != nil {
+		log.Printf("Failed to autosave: %v\n", err)
+	}
+}
+
+// ClientResume offers to resume the saved game at path, if there is one.
+func ClientResume(path string) (Snapshot, bool) {
+	s, err := LoadSnapshot(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, false
+	}
+	if err != nil {
+		fmt.Printf("Found a saved game that could not be loaded: %v\n", err)
+		return Snapshot{}, false
+	}
+
+	fmt.Printf("Found a saved game with %d units and %d resources.\n", len(s.Units), s.Resources)
+	fmt.Println("Resume it? (y/n)")
+	words := GetInput()
+	if len(words) == 0 || !strings.HasPrefix(strings.ToLower(words[0]), "y") {
+		return Snapshot{}, false
+	}
+	return s, true
+}
@@ -0,0 +1,125 @@
+package gamelogic
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	gs := NewGameState("alice")
+	gs.addUnit(Unit{1, RankInfantry, "europe"})
+	gs.addUnit(Unit{2, RankCavalry, "asia"})
+	gs.newUnitID()
+	gs.allies["bob"] = newTestPlayer("bob", Unit{1, RankArtillery, "africa"})
+	gs.resources = 42
+	gs.turn = 7
+	gs.team = "red"
+
+	path := filepath.Join(t.TempDir(), SnapshotPath("alice"))
+	err := gs.SaveSnapshot(path)
+	if err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	s, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+
+	restored := NewGameState("alice")
+	restored.Restore(s)
+	if units := restored.GetPlayerSnap().Units; len(units) != 2 || units[2] != (Unit{2, RankCavalry, "asia"}) {
+		t.Errorf("units = %v", units)
+	}
+	if !restored.IsAlly("bob") {
+		t.Error("bob is no longer an ally")
+	}
+	if restored.GetResources() != 42 || restored.turn != 7 || restored.team != "red" {
+		t.Errorf("resources %d, turn %d, team %q, want 42, 7, red", restored.GetResources(), restored.turn, restored.team)
+	}
+	// Unit 3 was handed out before saving, even though it never spawned
+	if id := restored.newUnitID(); id != 4 {
+		t.Errorf("next unit id = %d, want 4", id)
+	}
+}
+
+func TestRestoreWithoutNextUnitID(t *testing.T) {
+	gs := NewGameState("alice")
+	gs.Restore(Snapshot{
+		Version:  SnapshotVersion,
+		Username: "alice",
+		Units:    map[int]Unit{5: {5, RankInfantry, "europe"}},
+	})
+	if id := gs.newUnitID(); id != 6 {
+		t.Errorf("next unit id = %d, want 6", id)
+	}
+}
+
+func TestLoadSnapshotRejectsNewerVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peril_alice.json")
+	err := os.WriteFile(path, []byte(`{"Version": 99, "Username": "alice"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadSnapshot(path)
+	if err == nil {
+		t.Fatal("LoadSnapshot accepted a snapshot from a newer version")
+	}
+}
+
+func TestWorldSnapshotRestore(t *testing.T) {
+	w := NewWorld()
+	treaties := NewTreaties()
+	w.AddPlayer("alice")
+	w.AddPlayer("bob")
+	w.players["alice"].Units[1] = Unit{1, RankInfantry, "europe"}
+	w.eliminated["bob"] = true
+	w.turns["alice"] = 3
+	w.SetPaused(true)
+	treaties.Record(Diplomacy{Action: DiplomacyProposeAlliance, From: newTestPlayer("alice"), To: "bob"}, time.Now())
+	treaties.Record(Diplomacy{Action: DiplomacyAcceptAlliance, From: newTestPlayer("bob"), To: "alice"}, time.Now())
+
+	path, err := WorldSavePath(t.TempDir(), "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveWorld(path, w.GetSnapshot(treaties))
+	if err != nil {
+		t.Fatalf("SaveWorld: %v", err)
+	}
+	ws, err := LoadWorld(path)
+	if err != nil {
+		t.Fatalf("LoadWorld: %v", err)
+	}
+
+	// Carol is connected to the world we restore into but not in the save,
+	// and bob is in the save but not connected
+	restored := NewWorld()
+	restoredTreaties := NewTreaties()
+	restored.AddPlayer("alice")
+	restored.AddPlayer("carol")
+	restored.Restore(ws, restoredTreaties)
+
+	if !restored.IsPaused() || !restored.IsEliminated("bob") || restored.turns["alice"] != 3 {
+		t.Errorf("paused %v, bob eliminated %v, alice's turns %d", restored.IsPaused(), restored.IsEliminated("bob"), restored.turns["alice"])
+	}
+	if !restoredTreaties.IsAllied("alice", "bob") {
+		t.Error("alice and bob are no longer allied")
+	}
+	online := map[string]bool{}
+	for _, s := range restored.GetStandings() {
+		online[s.Username] = s.Online
+	}
+	if len(online) != 2 || !online["alice"] || online["bob"] {
+		t.Errorf("online = %v, want alice online and bob offline", online)
+	}
+
+	for _, s := range ws.PlayerSnapshots() {
+		if s.Username == "alice" {
+			if len(s.Units) != 1 || s.Turn != 3 || s.Allies["bob"].Username != "bob" {
+				t.Errorf("alice's snapshot = %+v", s)
+			}
+		}
+	}
+}
@@ -5,30 +5,40 @@ import (
 	"fmt"
 )
 
-func (gs *GameState) CommandSpawn(words []string) error {
+func (gs *GameState) CommandSpawn(words []string) (Spawn, error) {
+	defer gs.changed()
+	if gs.IsEliminated() {
+		return Spawn{}, errors.New("you have been eliminated, you can not spawn units")
+	}
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return Spawn{}, errors.New("usage: spawn <location> <rank>")
 	}
 
 	locationName := words[1]
 	locations := getAllLocations()
 	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+		return Spawn{}, fmt.Errorf("error: %s is not a valid location", locationName)
 	}
 
 	rank := words[2]
 	units := getAllRanks()
 	if _, ok := units[UnitRank(rank)]; !ok {
-		return fmt.Errorf("error: %s is not a valid unit", rank)
+		return Spawn{}, fmt.Errorf("error: %s is not a valid unit", rank)
+	}
+
+	cost := RankCost(UnitRank(rank))
+	if !gs.spend(cost) {
+		return Spawn{}, fmt.Errorf("error: a(n) %s costs %d, you have %d", rank, cost, gs.GetResources())
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
+	id := gs.newUnitID()
+	unit := Unit{
 		ID:       id,
 		Rank:     UnitRank(rank),
 		Location: Location(locationName),
-	})
+	}
+	gs.addUnit(unit)
 
-	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
-	return nil
+	fmt.Printf("Spawned a(n) %s in %s with id %v for %d resources\n", rank, locationName, id, cost)
+	return Spawn{Username: gs.GetUsername(), Unit: unit}, nil
 }
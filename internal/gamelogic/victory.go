@@ -0,0 +1,226 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// VictoryConditions control when the server ends the game. A zero value
+// for a condition disables it.
+type VictoryConditions struct {
+	Regions     int
+	Elimination bool
+	TimeLimit   time.Duration
+}
+
+type Standing struct {
+	Username   string
+	Units      int
+	Regions    int
+	Score      int
+	Eliminated bool
+	Online     bool
+}
+
+type GameOver struct {
+	Reason    string
+	Winner    string
+	Standings []Standing
+}
+
+func (gs *GameState) HandleGameOver(g GameOver) {
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Game Over ====")
+	fmt.Println(g.Reason)
+	if g.Winner == gs.GetUsername() {
+		fmt.Println("You have won the game!")
+	}
+	fmt.Println("Final standings:")
+	for i, s := range g.Standings {
+		status := ""
+		if s.Eliminated {
+			status = " (eliminated)"
+		}
+		fmt.Printf("%d. %s: %d points, %d units in %d region(s)%s\n", i+1, s.Username, s.Score, s.Units, s.Regions, status)
+	}
+}
+
+// ValidateWarResult checks a war result an attacker reported against the
+// world: both sides have to be in the game with units where the war was
+// fought, and no one can lose more units than they had there.
+func (w *World) ValidateWarResult(result WarResult) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if result.Attacker == result.Defender {
+		return fmt.Errorf("%s can not go to war with themselves", result.Attacker)
+	}
+	sides := map[string]bool{result.Attacker: true, result.Defender: true}
+	if !sides[result.Winner] || !sides[result.Loser] || result.Winner == result.Loser {
+		return fmt.Errorf("%s and %s do not match the sides of the war", result.Winner, result.Loser)
+	}
+	for username := range sides {
+		p, ok := w.players[username]
+		if !ok {
+			return fmt.Errorf("%s has not joined the game", username)
+		}
+		if len(UnitsInLocation(p, result.Location).Units) == 0 {
+			return fmt.Errorf("%s has no units in %s", username, result.Location)
+		}
+	}
+	for username, killed := range result.Casualties {
+		// Players who were kicked or banned are skipped when applying
+		p, ok := w.players[username]
+		if !ok {
+			continue
+		}
+		if held := len(UnitsInLocation(p, result.Location).Units); killed < 0 || killed > held {
+			return fmt.Errorf("%s can not lose %d unit(s) in %s, they have %d", username, killed, result.Location, held)
+		}
+	}
+	for _, username := range result.Eliminated {
+		if result.Casualties[username] == 0 {
+			return fmt.Errorf("%s was eliminated without losing any units", username)
+		}
+	}
+	return nil
+}
+
+// ApplyWarResult removes the units killed in a war and records any players
+// who were eliminated.
+func (w *World) ApplyWarResult(result WarResult) {
+	defer w.changed()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for username := range result.Casualties {
+		// Players who were kicked or banned have no units left to lose
+		p, ok := w.players[username]
+		if !ok {
+			continue
+		}
+		for k, v := range p.Units {
+			if v.Location == result.Location {
+				delete(p.Units, k)
+			}
+		}
+		if len(p.Units) == 0 {
+			w.eliminated[username] = true
+		}
+	}
+	for _, username := range result.Eliminated {
+		w.eliminated[username] = true
+	}
+}
+
+func (w *World) IsEliminated(username string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.eliminated[username]
+}
+
+// CheckVictory reports whether any of the victory conditions have been met,
+// returning the final results the first time they are.
+func (w *World) CheckVictory(vc VictoryConditions, now time.Time) (GameOver, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.over || w.started.IsZero() {
+		return GameOver{}, false
+	}
+
+	standings := w.getStandings()
+	active := []Standing{}
+	for _, s := range standings {
+		if !s.Eliminated {
+			active = append(active, s)
+		}
+	}
+
+	// Conquest only counts against an opponent, and only for regions no one
+	// else has units in
+	var conqueror string
+	controlled := w.controlledRegions()
+	for _, s := range active {
+		if vc.Regions > 0 && len(standings) > 1 && controlled[s.Username] >= vc.Regions {
+			conqueror = s.Username
+			break
+		}
+	}
+
+	var over GameOver
+	switch {
+	case conqueror != "":
+		over.Reason = fmt.Sprintf("%s controls %d regions.", conqueror, controlled[conqueror])
+		over.Winner = conqueror
+
+	case vc.Elimination && len(standings) > 1 && len(active) == 1:
+		over.Reason = fmt.Sprintf("%s is the last player standing.", active[0].Username)
+		over.Winner = active[0].Username
+
+	case vc.TimeLimit > 0 && now.Sub(w.started) >= vc.TimeLimit:
+		over.Reason = fmt.Sprintf("The time limit of %v has been reached.", vc.TimeLimit)
+		if len(active) > 0 {
+			over.Winner = active[0].Username
+		}
+
+	default:
+		return GameOver{}, false
+	}
+
+	w.over = true
+	over.Standings = standings
+	return over, true
+}
+
+// controlledRegions counts, for each player, the regions where they are the
+// only one with units.
+func (w *World) controlledRegions() map[string]int {
+	occupants := map[Location][]string{}
+	for username, p := range w.players {
+		for loc := range occupiedLocations(p) {
+			occupants[loc] = append(occupants[loc], username)
+		}
+	}
+	controlled := map[string]int{}
+	for _, usernames := range occupants {
+		if len(usernames) == 1 {
+			controlled[usernames[0]]++
+		}
+	}
+	return controlled
+}
+
+func (w *World) GetStandings() []Standing {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.getStandings()
+}
+
+func (w *World) getStandings() []Standing {
+	standings := []Standing{}
+	for username, p := range w.players {
+		units := []Unit{}
+		for _, v := range p.Units {
+			units = append(units, v)
+		}
+		regions := len(occupiedLocations(p))
+		standings = append(standings, Standing{
+			Username:   username,
+			Units:      len(units),
+			Regions:    regions,
+			Score:      unitsToPowerLevel(units) + regions*incomePerRegion,
+			Eliminated: w.eliminated[username],
+			Online:     w.online[username],
+		})
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Eliminated != standings[j].Eliminated {
+			return !standings[i].Eliminated
+		}
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+		return standings[i].Username < standings[j].Username
+	})
+	return standings
+}
@@ -0,0 +1,117 @@
+package gamelogic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckVictory(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions VictoryConditions
+		units      map[string][]Unit
+		eliminated []string
+		elapsed    time.Duration
+		over       bool
+		winner     string
+	}{
+		{
+			name:       "conquest",
+			conditions: VictoryConditions{Regions: 2},
+			units: map[string][]Unit{
+				"alice": {{1, RankInfantry, "europe"}, {2, RankInfantry, "asia"}},
+				"bob":   {{1, RankInfantry, "africa"}},
+			},
+			over:   true,
+			winner: "alice",
+		},
+		{
+			name:       "shared regions are not controlled",
+			conditions: VictoryConditions{Regions: 2},
+			units: map[string][]Unit{
+				"alice": {{1, RankInfantry, "europe"}, {2, RankInfantry, "asia"}},
+				"bob":   {{1, RankInfantry, "asia"}},
+			},
+		},
+		{
+			name:       "conquest needs an opponent",
+			conditions: VictoryConditions{Regions: 2},
+			units: map[string][]Unit{
+				"alice": {{1, RankInfantry, "europe"}, {2, RankInfantry, "asia"}},
+			},
+		},
+		{
+			name:       "last player standing",
+			conditions: VictoryConditions{Elimination: true},
+			units: map[string][]Unit{
+				"alice": {{1, RankInfantry, "europe"}},
+				"bob":   {},
+			},
+			eliminated: []string{"bob"},
+			over:       true,
+			winner:     "alice",
+		},
+		{
+			name:       "elimination disabled",
+			conditions: VictoryConditions{},
+			units: map[string][]Unit{
+				"alice": {{1, RankInfantry, "europe"}},
+				"bob":   {},
+			},
+			eliminated: []string{"bob"},
+		},
+		{
+			name:       "time limit goes to the highest score",
+			conditions: VictoryConditions{TimeLimit: time.Hour},
+			units: map[string][]Unit{
+				"alice": {{1, RankInfantry, "europe"}},
+				"bob":   {{1, RankArtillery, "asia"}},
+			},
+			elapsed: time.Hour,
+			over:    true,
+			winner:  "bob",
+		},
+		{
+			name:       "before the time limit",
+			conditions: VictoryConditions{TimeLimit: time.Hour},
+			units: map[string][]Unit{
+				"alice": {{1, RankInfantry, "europe"}},
+			},
+			elapsed: time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld()
+			for username, units := range tt.units {
+				w.AddPlayer(username)
+				for _, u := range units {
+					w.players[username].Units[u.ID] = u
+				}
+			}
+			for _, username := range tt.eliminated {
+				w.eliminated[username] = true
+			}
+
+			over, ok := w.CheckVictory(tt.conditions, w.started.Add(tt.elapsed))
+			if ok != tt.over {
+				t.Fatalf("over = %v, want %v", ok, tt.over)
+			}
+			if !ok {
+				return
+			}
+			if over.Winner != tt.winner {
+				t.Errorf("winner = %s, want %s", over.Winner, tt.winner)
+			}
+			if len(over.Standings) != len(tt.units) || over.Standings[0].Username != tt.winner {
+				t.Errorf("standings = %+v, want %s first", over.Standings, tt.winner)
+			}
+
+			// The game only ends once
+			_, ok = w.CheckVictory(tt.conditions, w.started.Add(tt.elapsed))
+			if ok {
+				t.Error("CheckVictory reported the game over twice")
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+)
+
+// View is what one player is allowed to know about everyone else. Allies
+// are sent in full, so clients never fight alongside units that have moved
+// or died since they last heard from them.
+type View struct {
+	Username string
+	Visible  []Player
+	Allies   []Player
+}
+
+func getAdjacentLocations() map[Location][]Location {
+	return map[Location][]Location{
+		"americas":   {"europe", "africa", "asia", "antarctica"},
+		"europe":     {"americas", "africa", "asia"},
+		"africa":     {"americas", "europe", "asia", "antarctica"},
+		"asia":       {"americas", "europe", "africa", "australia"},
+		"australia":  {"asia", "antarctica"},
+		"antarctica": {"americas", "africa", "australia"},
+	}
+}
+
+// visibleLocations returns the locations a player occupies and those
+// adjacent to them.
+func visibleLocations(p Player) map[Location]struct{} {
+	adjacent := getAdjacentLocations()
+	locations := map[Location]struct{}{}
+	for loc := range occupiedLocations(p) {
+		locations[loc] = struct{}{}
+		for _, adj := range adjacent[loc] {
+			locations[adj] = struct{}{}
+		}
+	}
+	return locations
+}
+
+// unitsIn returns a copy of p holding only the units in locations.
+func unitsIn(p Player, locations map[Location]struct{}) Player {
+	units := map[int]Unit{}
+	for k, v := range p.Units {
+		if _, ok := locations[v.Location]; ok {
+			units[k] = v
+		}
+	}
+	return Player{Username: p.Username, Units: units}
+}
+
+// UnitsInLocation returns a copy of p holding only the units in loc.
+func UnitsInLocation(p Player, loc Location) Player {
+	return unitsIn(p, map[Location]struct{}{loc: {}})
+}
+
+func (gs *GameState) canSee(loc Location) bool {
+	_, ok := visibleLocations(gs.GetPlayerSnap())[loc]
+	return ok
+}
+
+// CanSeeMove reports whether the player may see the units in a move: their
+// own, an ally's, or one into a location they can see.
+func (gs *GameState) CanSeeMove(move ArmyMove) bool {
+	return move.Player.Username == gs.GetUsername() ||
+		gs.IsAlly(move.Player.Username) ||
+		gs.canSee(move.ToLocation)
+}
+
+func (gs *GameState) HandleView(v View) {
+	defer gs.changed()
+	visible := map[string]Player{}
+	for _, p := range v.Visible {
+		visible[p.Username] = p
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.visible = visible
+	for _, ally := range v.Allies {
+		if _, ok := gs.allies[ally.Username]; ok {
+			gs.allies[ally.Username] = ally
+		}
+	}
+}
+
+func (gs *GameState) getVisibleSnap() []Player {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	players := []Player{}
+	for _, p := range gs.visible {
+		players = append(players, p)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Username < players[j].Username
+	})
+	return players
+}
+
+func printVisible(players []Player) {
+	fmt.Println("Enemy units you can see:")
+	seen := 0
+	for _, p := range players {
+		for _, unit := range p.Units {
+			fmt.Printf("* %s: %v, %v\n", p.Username, unit.Location, unit.Rank)
+			seen++
+		}
+	}
+	if seen == 0 {
+		fmt.Println("  none")
+	}
+}
+
+// MoveWatchers returns everyone who should hear about a move: the player
+// who made it, their allies, and anyone who can see where it went.
+func (w *World) MoveWatchers(move ArmyMove, treaties *Treaties) []string {
+	watchers := []string{}
+	for _, p := range w.GetPlayersSnap() {
+		_, sees := visibleLocations(p)[move.ToLocation]
+		if p.Username == move.Player.Username || sees || treaties.IsAllied(p.Username, move.Player.Username) {
+			watchers = append(watchers, p.Username)
+		}
+	}
+	return watchers
+}
+
+// GetViews builds a filtered view of the world for every player.
+func (w *World) GetViews(treaties *Treaties) []View {
+	players := w.GetPlayersSnap()
+	views := []View{}
+	for _, viewer := range players {
+		locations := visibleLocations(viewer)
+		visible := []Player{}
+		allies := []Player{}
+		for _, other := range players {
+			if other.Username == viewer.Username {
+				continue
+			}
+			if treaties.IsAllied(viewer.Username, other.Username) {
+				allies = append(allies, other)
+				continue
+			}
+			p := unitsIn(other, locations)
+			if len(p.Units) > 0 {
+				visible = append(visible, p)
+			}
+		}
+		views = append(views, View{Username: viewer.Username, Visible: visible, Allies: allies})
+	}
+	return views
+}
@@ -0,0 +1,74 @@
+package gamelogic
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCanSeeMove(t *testing.T) {
+	gs := NewGameState("alice")
+	gs.addUnit(Unit{1, RankInfantry, "australia"})
+	gs.allies["carol"] = newTestPlayer("carol")
+
+	tests := []struct {
+		name string
+		move ArmyMove
+		want bool
+	}{
+		{"our own", ArmyMove{Player: newTestPlayer("alice"), ToLocation: "europe"}, true},
+		{"an ally's", ArmyMove{Player: newTestPlayer("carol"), ToLocation: "europe"}, true},
+		{"where we are", ArmyMove{Player: newTestPlayer("bob"), ToLocation: "australia"}, true},
+		{"next to us", ArmyMove{Player: newTestPlayer("bob"), ToLocation: "asia"}, true},
+		{"out of sight", ArmyMove{Player: newTestPlayer("bob"), ToLocation: "europe"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gs.CanSeeMove(tt.move); got != tt.want {
+				t.Errorf("CanSeeMove = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetViews(t *testing.T) {
+	w := NewWorld()
+	for _, username := range []string{"alice", "bob", "carol"} {
+		w.AddPlayer(username)
+	}
+	w.players["alice"].Units[1] = Unit{1, RankInfantry, "australia"}
+	w.players["bob"].Units[1] = Unit{1, RankInfantry, "asia"}
+	w.players["bob"].Units[2] = Unit{2, RankInfantry, "europe"}
+	w.players["carol"].Units[1] = Unit{1, RankInfantry, "americas"}
+
+	treaties := NewTreaties()
+	treaties.Record(Diplomacy{Action: DiplomacyProposeAlliance, From: newTestPlayer("carol"), To: "alice"}, time.Now())
+	treaties.Record(Diplomacy{Action: DiplomacyAcceptAlliance, From: newTestPlayer("alice"), To: "carol"}, time.Now())
+
+	views := map[string]View{}
+	for _, v := range w.GetViews(treaties) {
+		views[v.Username] = v
+	}
+
+	// Alice sees bob's units next to her, but not the rest of his army, and
+	// all of her ally's
+	alice := views["alice"]
+	if len(alice.Visible) != 1 || len(alice.Visible[0].Units) != 1 || alice.Visible[0].Units[1].Location != "asia" {
+		t.Errorf("alice sees %v, want only bob's units in asia", alice.Visible)
+	}
+	if len(alice.Allies) != 1 || alice.Allies[0].Username != "carol" || len(alice.Allies[0].Units) != 1 {
+		t.Errorf("alice's allies = %v, want all of carol's units", alice.Allies)
+	}
+
+	// Bob sees everyone he borders and has no allies
+	bob := views["bob"]
+	if len(bob.Visible) != 2 || len(bob.Allies) != 0 {
+		t.Errorf("bob sees %v with allies %v, want alice and carol", bob.Visible, bob.Allies)
+	}
+
+	watchers := w.MoveWatchers(ArmyMove{Player: newTestPlayer("carol"), ToLocation: "antarctica"}, treaties)
+	slices.Sort(watchers)
+	if !slices.Equal(watchers, []string{"alice", "carol"}) {
+		t.Errorf("watchers = %v, want alice and carol", watchers)
+	}
+}
@@ -12,9 +12,54 @@ const (
 	WarOutcomeYouWon
 	WarOutcomeOpponentWon
 	WarOutcomeDraw
+	WarOutcomeAllied
 )
 
-func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
+// WarResult is a structured record of a fought war, published so the server
+// can keep its view of the world in sync.
+type WarResult struct {
+	Attacker   string
+	Defender   string
+	Winner     string
+	Loser      string
+	Location   Location
+	Draw       bool
+	Casualties map[string]int
+	Eliminated []string
+}
+
+// NewRecognitionOfWar is what a defender publishes when move lands on their
+// units. It only reveals the defending units in the contested location,
+// keeping the rest of the board hidden from the attacker. The attacker
+// fights with their whole army there, not just the units we saw move, since
+// they fill in their own side when resolving the war.
+func (gs *GameState) NewRecognitionOfWar(move ArmyMove) RecognitionOfWar {
+	allies := []Player{}
+	for _, ally := range gs.GetAlliesSnap() {
+		allies = append(allies, UnitsInLocation(ally, move.ToLocation))
+	}
+	return RecognitionOfWar{
+		Attacker:       move.Player,
+		Defender:       UnitsInLocation(gs.GetPlayerSnap(), move.ToLocation),
+		DefenderAllies: allies,
+	}
+}
+
+// DescribeWar is the game log entry for a war HandleWar fought. It returns
+// false if the outcome means no war was fought.
+func DescribeWar(outcome WarOutcome, result WarResult) (string, bool) {
+	switch outcome {
+	case WarOutcomeOpponentWon, WarOutcomeYouWon:
+		return fmt.Sprintf("%s won a war against %s", result.Winner, result.Loser), true
+	case WarOutcomeDraw:
+		return fmt.Sprintf("A war between %s and %s resulted in a draw", result.Winner, result.Loser), true
+	default:
+		return "", false
+	}
+}
+
+func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, result WarResult) {
+	defer gs.changed()
 	defer fmt.Println("------------------------")
 	fmt.Println()
 	fmt.Println("==== War Declared ====")
@@ -24,68 +69,156 @@ func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner
 
 	if player.Username == rw.Defender.Username {
 		fmt.Printf("%s, you published the war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+		return WarOutcomeNotInvolved, WarResult{}
 	}
 
 	if player.Username != rw.Attacker.Username {
 		fmt.Printf("%s, you are not involved in this war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+		return WarOutcomeNotInvolved, WarResult{}
+	}
+
+	if gs.IsAlly(rw.Defender.Username) {
+		fmt.Printf("%s, you are now allied with %s. No war will be fought.\n", player.Username, rw.Defender.Username)
+		return WarOutcomeAllied, WarResult{}
 	}
 
-	overlappingLocation := getOverlappingLocation(rw.Attacker, rw.Defender)
+	// We know our own army better than the defender, who only saw the
+	// units that moved
+	overlappingLocation := getOverlappingLocation(player, rw.Defender)
 	if overlappingLocation == "" {
 		fmt.Printf("Error! No units are in the same location. No war will be fought.\n")
-		return WarOutcomeNoUnits, "", ""
+		return WarOutcomeNoUnits, WarResult{}
 	}
 
-	attackerUnits := []Unit{}
-	defenderUnits := []Unit{}
-	for _, unit := range rw.Attacker.Units {
-		if unit.Location == overlappingLocation {
-			attackerUnits = append(attackerUnits, unit)
+	result = WarResult{
+		Attacker:   rw.Attacker.Username,
+		Defender:   rw.Defender.Username,
+		Location:   overlappingLocation,
+		Casualties: map[string]int{},
+	}
+
+	// Allies fight alongside whoever they are allied with, and share their
+	// fate
+	attackers := []Player{UnitsInLocation(player, overlappingLocation)}
+	for _, ally := range gs.GetAlliesSnap() {
+		if ally.Username == rw.Defender.Username {
+			continue
 		}
+		attackers = appendAlly(attackers, ally, overlappingLocation, rw.Attacker.Username)
 	}
-	for _, unit := range rw.Defender.Units {
-		if unit.Location == overlappingLocation {
-			defenderUnits = append(defenderUnits, unit)
+	defenders := []Player{UnitsInLocation(rw.Defender, overlappingLocation)}
+	for _, ally := range rw.DefenderAllies {
+		if ally.Username == rw.Attacker.Username {
+			continue
 		}
+		defenders = appendAlly(defenders, ally, overlappingLocation, rw.Defender.Username)
 	}
 
 	fmt.Printf("%s's units:\n", rw.Attacker.Username)
-	for _, unit := range attackerUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
+	printSide(attackers)
 	fmt.Printf("%s's units:\n", rw.Defender.Username)
-	for _, unit := range defenderUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
-	attackerPower := unitsToPowerLevel(attackerUnits)
-	defenderPower := unitsToPowerLevel(defenderUnits)
+	printSide(defenders)
+	attackerPower := sideToPowerLevel(attackers)
+	defenderPower := sideToPowerLevel(defenders)
 	fmt.Printf("Attacker has a power level of %v\n", attackerPower)
 	fmt.Printf("Defender has a power level of %v\n", defenderPower)
 	if attackerPower > defenderPower {
 		fmt.Printf("%s has won the war!\n", rw.Attacker.Username)
-		if player.Username == rw.Defender.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Attacker.Username, rw.Defender.Username
-		}
-		return WarOutcomeYouWon, rw.Attacker.Username, rw.Defender.Username
+		result.Winner, result.Loser = rw.Attacker.Username, rw.Defender.Username
+		gs.killSide(defenders, &result)
+		return WarOutcomeYouWon, result
 	} else if defenderPower > attackerPower {
 		fmt.Printf("%s has won the war!\n", rw.Defender.Username)
-		if player.Username == rw.Attacker.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Defender.Username, rw.Attacker.Username
-		}
-		return WarOutcomeYouWon, rw.Defender.Username, rw.Attacker.Username
+		result.Winner, result.Loser = rw.Defender.Username, rw.Attacker.Username
+		fmt.Println("You have lost the war!")
+		gs.killSide(attackers, &result)
+		return WarOutcomeOpponentWon, result
 	}
 	fmt.Println("The war ended in a draw!")
-	fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-	gs.removeUnitsInLocation(overlappingLocation)
-	return WarOutcomeDraw, rw.Attacker.Username, rw.Defender.Username
+	result.Winner, result.Loser, result.Draw = rw.Attacker.Username, rw.Defender.Username, true
+	gs.killSide(attackers, &result)
+	gs.killSide(defenders, &result)
+	return WarOutcomeDraw, result
+}
+
+// appendAlly adds the units an ally has in loc to a side, if they have any.
+func appendAlly(side []Player, ally Player, loc Location, joins string) []Player {
+	p := UnitsInLocation(ally, loc)
+	if len(p.Units) == 0 {
+		return side
+	}
+	for _, unit := range p.Units {
+		fmt.Printf("%s's %v joins %s\n", ally.Username, unit.Rank, joins)
+	}
+	return append(side, p)
+}
+
+func printSide(side []Player) {
+	for _, p := range side {
+		for _, unit := range p.Units {
+			fmt.Printf("  * %v\n", unit.Rank)
+		}
+	}
+}
+
+func sideToPowerLevel(side []Player) int {
+	units := []Unit{}
+	for _, p := range side {
+		for _, unit := range p.Units {
+			units = append(units, unit)
+		}
+	}
+	return unitsToPowerLevel(units)
+}
+
+// killSide records every unit on the losing side as a casualty. Our own are
+// removed here, everyone else's when the server applies the result.
+func (gs *GameState) killSide(side []Player, result *WarResult) {
+	for _, p := range side {
+		if p.Username == gs.GetUsername() {
+			gs.killUnitsInLocation(result.Location, result)
+			fmt.Printf("Your units in %s have been killed.\n", result.Location)
+			continue
+		}
+		if len(p.Units) == 0 {
+			continue
+		}
+		result.Casualties[p.Username] += len(p.Units)
+		fmt.Printf("%s's units in %s have been killed.\n", p.Username, result.Location)
+	}
+}
+
+// HandleCasualties removes our units killed in a war another player
+// resolved, such as one fought by an ally.
+func (gs *GameState) HandleCasualties(result WarResult) {
+	defer gs.changed()
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Casualties ====")
+
+	username := gs.GetUsername()
+	if result.Casualties[username] == 0 {
+		fmt.Printf("You lost no units in the war in %s.\n", result.Location)
+		return
+	}
+	killed := gs.removeUnitsInLocation(result.Location)
+	fmt.Printf("You lost %d unit(s) in the war between %s and %s in %s.\n", killed, result.Attacker, result.Defender, result.Location)
+	if len(gs.getUnitsSnap()) == 0 && !gs.IsEliminated() {
+		gs.eliminate()
+		fmt.Println("You have lost your last unit and have been eliminated!")
+	}
+}
+
+// killUnitsInLocation removes the player's units in loc, recording the
+// casualties and whether the player was eliminated in result.
+func (gs *GameState) killUnitsInLocation(loc Location, result *WarResult) {
+	username := gs.GetUsername()
+	result.Casualties[username] += gs.removeUnitsInLocation(loc)
+	if len(gs.getUnitsSnap()) == 0 {
+		gs.eliminate()
+		fmt.Println("You have lost your last unit and have been eliminated!")
+		result.Eliminated = append(result.Eliminated, username)
+	}
 }
 
 func unitsToPowerLevel(units []Unit) int {
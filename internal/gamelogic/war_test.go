@@ -0,0 +1,187 @@
+package gamelogic
+
+import (
+	"slices"
+	"testing"
+)
+
+func newTestPlayer(username string, units ...Unit) Player {
+	p := Player{Username: username, Units: map[int]Unit{}}
+	for _, u := range units {
+		p.Units[u.ID] = u
+	}
+	return p
+}
+
+func TestHandleWar(t *testing.T) {
+	tests := []struct {
+		name       string
+		attacker   []Unit
+		defender   []Unit
+		outcome    WarOutcome
+		winner     string
+		casualties map[string]int
+		eliminated []string
+		survivors  int
+	}{
+		{
+			name:       "attacker wins",
+			attacker:   []Unit{{1, RankArtillery, "europe"}},
+			defender:   []Unit{{1, RankInfantry, "europe"}, {2, RankCavalry, "europe"}},
+			outcome:    WarOutcomeYouWon,
+			winner:     "alice",
+			casualties: map[string]int{"bob": 2},
+			survivors:  1,
+		},
+		{
+			name:       "defender wins",
+			attacker:   []Unit{{1, RankInfantry, "europe"}, {2, RankInfantry, "asia"}},
+			defender:   []Unit{{1, RankCavalry, "europe"}},
+			outcome:    WarOutcomeOpponentWon,
+			winner:     "bob",
+			casualties: map[string]int{"alice": 1},
+			survivors:  1,
+		},
+		{
+			name:       "attacker loses their last units",
+			attacker:   []Unit{{1, RankInfantry, "europe"}},
+			defender:   []Unit{{1, RankArtillery, "europe"}},
+			outcome:    WarOutcomeOpponentWon,
+			winner:     "bob",
+			casualties: map[string]int{"alice": 1},
+			eliminated: []string{"alice"},
+		},
+		{
+			name:       "draw",
+			attacker:   []Unit{{1, RankCavalry, "europe"}, {2, RankCavalry, "asia"}},
+			defender:   []Unit{{1, RankInfantry, "europe"}, {2, RankInfantry, "europe"}, {3, RankInfantry, "europe"}, {4, RankInfantry, "europe"}, {5, RankInfantry, "europe"}},
+			outcome:    WarOutcomeDraw,
+			winner:     "alice",
+			casualties: map[string]int{"alice": 1, "bob": 5},
+			survivors:  1,
+		},
+		{
+			name:     "no units in the same place",
+			attacker: []Unit{{1, RankInfantry, "asia"}},
+			defender: []Unit{{1, RankInfantry, "europe"}},
+			outcome:  WarOutcomeNoUnits,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewGameState("alice")
+			for _, u := range tt.attacker {
+				gs.addUnit(u)
+			}
+			rw := RecognitionOfWar{
+				Attacker: newTestPlayer("alice"),
+				Defender: newTestPlayer("bob", tt.defender...),
+			}
+
+			outcome, result := gs.HandleWar(rw)
+			if outcome != tt.outcome {
+				t.Fatalf("outcome = %v, want %v", outcome, tt.outcome)
+			}
+			if tt.outcome == WarOutcomeNoUnits {
+				return
+			}
+			if result.Winner != tt.winner {
+				t.Errorf("winner = %s, want %s", result.Winner, tt.winner)
+			}
+			if len(result.Casualties) != len(tt.casualties) {
+				t.Errorf("casualties = %v, want %v", result.Casualties, tt.casualties)
+			}
+			for username, want := range tt.casualties {
+				if got := result.Casualties[username]; got != want {
+					t.Errorf("%s lost %d unit(s), want %d", username, got, want)
+				}
+			}
+			if !slices.Equal(result.Eliminated, tt.eliminated) {
+				t.Errorf("eliminated = %v, want %v", result.Eliminated, tt.eliminated)
+			}
+			if got := len(gs.getUnitsSnap()); got != tt.survivors {
+				t.Errorf("alice has %d unit(s) left, want %d", got, tt.survivors)
+			}
+			if gs.IsEliminated() != (len(tt.eliminated) > 0) {
+				t.Errorf("alice eliminated = %v", gs.IsEliminated())
+			}
+		})
+	}
+}
+
+func TestHandleWarAllies(t *testing.T) {
+	gs := NewGameState("alice")
+	gs.addUnit(Unit{1, RankInfantry, "europe"})
+	gs.allies["carol"] = newTestPlayer("carol", Unit{1, RankArtillery, "europe"})
+
+	// Carol's artillery tips the war alice's way, and dave fights for bob
+	// but shares his fate
+	rw := RecognitionOfWar{
+		Attacker:       newTestPlayer("alice"),
+		Defender:       newTestPlayer("bob", Unit{1, RankCavalry, "europe"}),
+		DefenderAllies: []Player{newTestPlayer("dave", Unit{1, RankCavalry, "europe"})},
+	}
+	outcome, result := gs.HandleWar(rw)
+	if outcome != WarOutcomeYouWon {
+		t.Fatalf("outcome = %v, want a win", outcome)
+	}
+	if result.Casualties["bob"] != 1 || result.Casualties["dave"] != 1 || len(result.Casualties) != 2 {
+		t.Errorf("casualties = %v, want bob and dave to lose one unit each", result.Casualties)
+	}
+
+	// An ally is never fought
+	gs.allies["bob"] = newTestPlayer("bob")
+	outcome, _ = gs.HandleWar(rw)
+	if outcome != WarOutcomeAllied {
+		t.Errorf("outcome = %v, want allied", outcome)
+	}
+}
+
+func TestValidateWarResult(t *testing.T) {
+	w := NewWorld()
+	w.AddPlayer("alice")
+	w.AddPlayer("bob")
+	w.players["alice"].Units[1] = Unit{1, RankArtillery, "europe"}
+	w.players["bob"].Units[1] = Unit{1, RankInfantry, "europe"}
+	w.players["bob"].Units[2] = Unit{2, RankInfantry, "asia"}
+
+	valid := WarResult{
+		Attacker:   "alice",
+		Defender:   "bob",
+		Winner:     "alice",
+		Loser:      "bob",
+		Location:   "europe",
+		Casualties: map[string]int{"bob": 1},
+	}
+	tests := []struct {
+		name   string
+		modify func(*WarResult)
+		ok     bool
+	}{
+		{"valid", func(*WarResult) {}, true},
+		{"against themselves", func(r *WarResult) { r.Defender, r.Loser = "alice", "alice" }, false},
+		{"winner not a side", func(r *WarResult) { r.Winner = "carol" }, false},
+		{"unknown defender", func(r *WarResult) { r.Defender, r.Loser = "carol", "carol" }, false},
+		{"no units there", func(r *WarResult) { r.Location = "asia" }, false},
+		{"too many casualties", func(r *WarResult) { r.Casualties = map[string]int{"bob": 2} }, false},
+		{"eliminated without losses", func(r *WarResult) { r.Eliminated = []string{"alice"} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := valid
+			tt.modify(&result)
+			err := w.ValidateWarResult(result)
+			if (err == nil) != tt.ok {
+				t.Errorf("ValidateWarResult = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+
+	w.ApplyWarResult(valid)
+	if units := w.players["bob"].Units; len(units) != 1 || units[2].Location != "asia" {
+		t.Errorf("bob has %v after losing in europe", units)
+	}
+	if w.IsEliminated("bob") {
+		t.Error("bob eliminated with units left in asia")
+	}
+}
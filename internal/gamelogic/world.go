@@ -0,0 +1,256 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// World is the server's authoritative view of every player in the game.
+type World struct {
+	players    map[string]Player
+	balances   map[string]int
+	eliminated map[string]bool
+	online     map[string]bool
+	paused     bool
+	started    time.Time
+	over       bool
+	turn       int
+	turns      map[string]int
+	onChange   func()
+	mu         *sync.RWMutex
+}
+
+func NewWorld() *World {
+	return &World{
+		players:    map[string]Player{},
+		balances:   map[string]int{},
+		eliminated: map[string]bool{},
+		online:     map[string]bool{},
+		turns:      map[string]int{},
+		mu:         &sync.RWMutex{},
+	}
+}
+
+// OnChange sets a function to call after each change to the players, their
+// units or whether the game is paused.
+func (w *World) OnChange(fn func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onChange = fn
+}
+
+// changed must be called without holding the lock, so onChange can read
+// the world.
+func (w *World) changed() {
+	w.mu.RLock()
+	fn := w.onChange
+	w.mu.RUnlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// AddPlayer registers a player, returning their balance. Rejoining players
+// keep their units and treasury.
+func (w *World) AddPlayer(username string) int {
+	defer w.changed()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.getOrAddPlayer(username)
+	w.online[username] = true
+	return w.balances[username]
+}
+
+// LeavePlayer marks a player as offline. They stay in the game, so their
+// units and treasury are still there when they rejoin.
+func (w *World) LeavePlayer(username string) {
+	defer w.changed()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.online, username)
+}
+
+// RemovePlayer takes a player and their units out of the game.
+func (w *World) RemovePlayer(username string) {
+	defer w.changed()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.players, username)
+	delete(w.balances, username)
+	delete(w.eliminated, username)
+	delete(w.online, username)
+	delete(w.turns, username)
+}
+
+// ApplySpawn charges a player for a new unit and places it in the world.
+// Only players who have joined can spawn.
+func (w *World) ApplySpawn(s Spawn) (int, error) {
+	defer w.changed()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p, ok := w.players[s.Username]
+	if !ok {
+		return 0, fmt.Errorf("%s has not joined the game", s.Username)
+	}
+	balance := w.balances[s.Username]
+
+	cost, ok := getRankCosts()[s.Unit.Rank]
+	if !ok {
+		return balance, fmt.Errorf("%s is not a valid unit", s.Unit.Rank)
+	}
+	if balance < cost {
+		return balance, fmt.Errorf("%s can not afford a(n) %s", s.Username, s.Unit.Rank)
+	}
+	if _, ok := p.Units[s.Unit.ID]; ok {
+		return balance, fmt.Errorf("%s already has a unit with id %d", s.Username, s.Unit.ID)
+	}
+	w.balances[s.Username] = balance - cost
+	p.Units[s.Unit.ID] = s.Unit
+	return w.balances[s.Username], nil
+}
+
+// ApplyMove moves a player's units. Only players who have joined, and are
+// still in the game, can move, and only units they already own. A move
+// changes where units are and nothing else.
+func (w *World) ApplyMove(move ArmyMove) error {
+	defer w.changed()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	username := move.Player.Username
+	p, ok := w.players[username]
+	if !ok {
+		return fmt.Errorf("%s has not joined the game", username)
+	}
+	if w.paused {
+		return errors.New("the game is paused")
+	}
+	if w.eliminated[username] {
+		return fmt.Errorf("%s has been eliminated", username)
+	}
+	if _, ok := getAllLocations()[move.ToLocation]; !ok {
+		return fmt.Errorf("%s is not a valid location", move.ToLocation)
+	}
+	for _, unit := range move.Units {
+		owned, ok := p.Units[unit.ID]
+		if !ok {
+			return fmt.Errorf("%s has no unit with id %d", username, unit.ID)
+		}
+		if unit.Rank != owned.Rank {
+			return fmt.Errorf("unit %d is a(n) %s, not a(n) %s", unit.ID, owned.Rank, unit.Rank)
+		}
+		if unit.Location != move.ToLocation {
+			return fmt.Errorf("unit %d is not moving to %s", unit.ID, move.ToLocation)
+		}
+	}
+	for _, unit := range move.Units {
+		owned := p.Units[unit.ID]
+		owned.Location = move.ToLocation
+		p.Units[unit.ID] = owned
+	}
+	w.turn++
+	w.turns[username]++
+	return nil
+}
+
+func (w *World) SetPaused(paused bool) {
+	defer w.changed()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused = paused
+}
+
+func (w *World) IsPaused() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.paused
+}
+
+// CollectIncome pays every player for each region they occupy.
+func (w *World) CollectIncome() []Income {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.paused {
+		return nil
+	}
+
+	incomes := []Income{}
+	for username, p := range w.players {
+		regions := len(occupiedLocations(p))
+		amount := regions * incomePerRegion
+		w.balances[username] += amount
+		incomes = append(incomes, Income{
+			Username: username,
+			Amount:   amount,
+			Regions:  regions,
+			Balance:  w.balances[username],
+		})
+	}
+	return incomes
+}
+
+func (w *World) GetBalance(username string) int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.balances[username]
+}
+
+func (w *World) GetPlayersSnap() []Player {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	players := []Player{}
+	for _, p := range w.players {
+		units := map[int]Unit{}
+		for k, v := range p.Units {
+			units[k] = v
+		}
+		players = append(players, Player{Username: p.Username, Units: units})
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Username < players[j].Username
+	})
+	return players
+}
+
+// GetRegions counts each player's units in every region, including empty
+// regions.
+func (w *World) GetRegions() map[Location]map[string]int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	regions := map[Location]map[string]int{}
+	for loc := range getAllLocations() {
+		regions[loc] = map[string]int{}
+	}
+	for username, p := range w.players {
+		for _, unit := range p.Units {
+			if regions[unit.Location] == nil {
+				regions[unit.Location] = map[string]int{}
+			}
+			regions[unit.Location][username]++
+		}
+	}
+	return regions
+}
+
+func (w *World) getOrAddPlayer(username string) Player {
+	p, ok := w.players[username]
+	if !ok {
+		if w.started.IsZero() {
+			w.started = time.Now()
+		}
+		p = Player{Username: username, Units: map[int]Unit{}}
+		w.players[username] = p
+		w.balances[username] = startingResources
+	}
+	return p
+}
+
+func occupiedLocations(p Player) map[Location]struct{} {
+	locations := map[Location]struct{}{}
+	for _, unit := range p.Units {
+		locations[unit.Location] = struct{}{}
+	}
+	return locations
+}
@@ -0,0 +1,230 @@
+package gamelogic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WorldSnapshotVersion is bumped whenever WorldSnapshot changes shape.
+const WorldSnapshotVersion = 1
+
+// worldSnapshotMigrations upgrades a raw world snapshot from the version it
+// is keyed by to the next one.
+var worldSnapshotMigrations = map[int]func(map[string]any) error{}
+
+// WorldSnapshot is everything the server needs to resume a game.
+type WorldSnapshot struct {
+	Version    int
+	SavedAt    time.Time
+	Players    map[string]Player
+	Balances   map[string]int
+	Eliminated map[string]bool
+	Paused     bool
+	Started    time.Time
+	Over       bool
+	Turn       int
+	Turns      map[string]int
+	Treaties   []Treaty
+}
+
+func (w *World) GetSnapshot(treaties *Treaties) WorldSnapshot {
+	players := map[string]Player{}
+	for _, p := range w.GetPlayersSnap() {
+		players[p.Username] = p
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	balances := map[string]int{}
+	for k, v := range w.balances {
+		balances[k] = v
+	}
+	eliminated := map[string]bool{}
+	for k, v := range w.eliminated {
+		eliminated[k] = v
+	}
+	turns := map[string]int{}
+	for k, v := range w.turns {
+		turns[k] = v
+	}
+	return WorldSnapshot{
+		Version:    WorldSnapshotVersion,
+		SavedAt:    time.Now(),
+		Players:    players,
+		Balances:   balances,
+		Eliminated: eliminated,
+		Paused:     w.paused,
+		Started:    w.started,
+		Over:       w.over,
+		Turn:       w.turn,
+		Turns:      turns,
+		Treaties:   treaties.GetTreatiesSnap(),
+	}
+}
+
+// Restore replaces the world and treaties with those in the snapshot.
+// Players who are connected stay online if they are in the snapshot; the
+// rest are no longer in the game.
+func (w *World) Restore(ws WorldSnapshot, treaties *Treaties) {
+	defer w.changed()
+	w.mu.Lock()
+	online := map[string]bool{}
+	w.players = map[string]Player{}
+	for k, p := range ws.Players {
+		units := map[int]Unit{}
+		for id, u := range p.Units {
+			units[id] = u
+		}
+		w.players[k] = Player{Username: p.Username, Units: units}
+		if w.online[k] {
+			online[k] = true
+		}
+	}
+	w.online = online
+	w.balances = map[string]int{}
+	for k, v := range ws.Balances {
+		w.balances[k] = v
+	}
+	w.eliminated = map[string]bool{}
+	for k, v := range ws.Eliminated {
+		w.eliminated[k] = v
+	}
+	w.paused = ws.Paused
+	w.started = ws.Started
+	w.over = ws.Over
+	w.turn = ws.Turn
+	w.turns = map[string]int{}
+	for k, v := range ws.Turns {
+		w.turns[k] = v
+	}
+	w.mu.Unlock()
+
+	treaties.Restore(ws.Treaties)
+}
+
+// PlayerSnapshots splits a world snapshot into the state each client holds.
+func (ws WorldSnapshot) PlayerSnapshots() []Snapshot {
+	snapshots := []Snapshot{}
+	for username, p := range ws.Players {
+		allies := map[string]Player{}
+		for _, t := range ws.Treaties {
+			other := ""
+			if t.Parties[0] == username {
+				other = t.Parties[1]
+			} else if t.Parties[1] == username {
+				other = t.Parties[0]
+			}
+			if ally, ok := ws.Players[other]; ok {
+				allies[other] = ally
+			}
+		}
+		snapshots = append(snapshots, Snapshot{
+			Version:    SnapshotVersion,
+			Username:   username,
+			Units:      p.Units,
+			Paused:     ws.Paused,
+			Turn:       ws.Turns[username],
+			Resources:  ws.Balances[username],
+			Eliminated: ws.Eliminated[username],
+			Allies:     allies,
+		})
+	}
+	return snapshots
+}
+
+func (t *Treaties) Restore(treaties []Treaty) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.signed = map[[2]string]Treaty{}
+	t.proposals = map[[2]string]time.Time{}
+	for _, treaty := range treaties {
+		t.signed[treatyKey(treaty.Parties[0], treaty.Parties[1])] = treaty
+	}
+}
+
+// WorldSavePath returns where a named save lives in dir, rejecting names
+// that would escape it.
+func WorldSavePath(dir, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid save name: %q", name)
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+func SaveWorld(path string, ws WorldSnapshot) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create save directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(ws, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode save: %v", err)
+	}
+	err = writeFileAtomic(path, data)
+	if err != nil {
+		return fmt.Errorf("could not write save: %v", err)
+	}
+	return nil
+}
+
+func LoadWorld(path string) (WorldSnapshot, error) {
+	var ws WorldSnapshot
+	err := loadVersioned(path, WorldSnapshotVersion, worldSnapshotMigrations, &ws)
+	if errors.Is(err, os.ErrNotExist) {
+		return WorldSnapshot{}, fmt.Errorf("no save at %s", path)
+	}
+	if err != nil {
+		return WorldSnapshot{}, err
+	}
+	return ws, nil
+}
+
+// HandleRestore replaces local state with the server's copy, keeping our
+// team since the server does not track it.
+func (gs *GameState) HandleRestore(s Snapshot) {
+	defer gs.changed()
+	defer fmt.Println("------------------------")
+	fmt.Println()
+	fmt.Println("==== Game Restored ====")
+
+	s.Team = gs.GetTeam()
+	gs.Restore(s)
+	fmt.Printf("The server restored your %d unit(s) and %d resources.\n", len(s.Units), s.Resources)
+}
+
+// WorldSave describes a saved game in a saves directory.
+type WorldSave struct {
+	Name    string
+	SavedAt time.Time
+}
+
+// ListWorldSaves returns the games saved in dir, newest first.
+func ListWorldSaves(dir string) ([]WorldSave, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	saves := []WorldSave{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read save: %v", err)
+		}
+		saves = append(saves, WorldSave{
+			Name:    strings.TrimSuffix(filepath.Base(path), ".json"),
+			SavedAt: info.ModTime(),
+		})
+	}
+	sort.Slice(saves, func(i, j int) bool {
+		return saves[i].SavedAt.After(saves[j].SavedAt)
+	})
+	return saves, nil
+}
@@ -0,0 +1,304 @@
+package leaderboard
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	initialRating = 1000
+	ratingK       = 32
+)
+
+type MatchKind string
+
+const (
+	MatchWar  MatchKind = "war"
+	MatchGame MatchKind = "game"
+)
+
+type Rating struct {
+	Username       string
+	Rating         int
+	WarsWon        int
+	WarsLost       int
+	WarsDrawn      int
+	UnitsDestroyed int
+	UnitsLost      int
+	GamesWon       int
+	GamesPlayed    int
+}
+
+type Match struct {
+	ID       int64
+	Time     time.Time
+	Kind     MatchKind
+	Winner   string
+	Loser    string
+	Draw     bool
+	Location gamelogic.Location
+	Detail   string
+}
+
+// Store records structured game results in an embedded SQLite database.
+type Store struct {
+	db *sql.DB
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS players (
+	username        TEXT PRIMARY KEY,
+	rating          INTEGER NOT NULL,
+	wars_won        INTEGER NOT NULL DEFAULT 0,
+	wars_lost       INTEGER NOT NULL DEFAULT 0,
+	wars_drawn      INTEGER NOT NULL DEFAULT 0,
+	units_destroyed INTEGER NOT NULL DEFAULT 0,
+	units_lost      INTEGER NOT NULL DEFAULT 0,
+	games_won       INTEGER NOT NULL DEFAULT 0,
+	games_played    INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS matches (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	time     INTEGER NOT NULL,
+	kind     TEXT NOT NULL,
+	winner   TEXT NOT NULL,
+	loser    TEXT NOT NULL,
+	draw     INTEGER NOT NULL,
+	location TEXT NOT NULL,
+	detail   TEXT NOT NULL
+);
+`
+
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(schema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to create schema: %v", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// RecordWar stores a war and updates both players' statistics and ratings.
+func (s *Store) RecordWar(result gamelogic.WarResult, at time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	winner, err := getRating(tx, result.Winner)
+	if err != nil {
+		return err
+	}
+	loser, err := getRating(tx, result.Loser)
+	if err != nil {
+		return err
+	}
+
+	score := 1.0
+	if result.Draw {
+		score = 0.5
+		winner.WarsDrawn++
+		loser.WarsDrawn++
+	} else {
+		winner.WarsWon++
+		loser.WarsLost++
+	}
+	winner.Rating, loser.Rating = updateRatings(winner.Rating, loser.Rating, score)
+
+	winner.UnitsDestroyed += result.Casualties[result.Loser]
+	winner.UnitsLost += result.Casualties[result.Winner]
+	loser.UnitsDestroyed += result.Casualties[result.Winner]
+	loser.UnitsLost += result.Casualties[result.Loser]
+
+	for _, r := range []Rating{winner, loser} {
+		err = putRating(tx, r)
+		if err != nil {
+			return err
+		}
+	}
+
+	detail := fmt.Sprintf("%s attacked %s", result.Attacker, result.Defender)
+	err = insertMatch(tx, Match{
+		Time:     at,
+		Kind:     MatchWar,
+		Winner:   result.Winner,
+		Loser:    result.Loser,
+		Draw:     result.Draw,
+		Location: result.Location,
+		Detail:   detail,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordGame stores the end of a game, crediting the winner and every
+// player in the standings with a game played.
+func (s *Store) RecordGame(over gamelogic.GameOver, at time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, standing := range over.Standings {
+		r, err := getRating(tx, standing.Username)
+		if err != nil {
+			return err
+		}
+		r.GamesPlayed++
+		if standing.Username == over.Winner {
+			r.GamesWon++
+		}
+		err = putRating(tx, r)
+		if err != nil {
+			return err
+		}
+
+		if standing.Username == over.Winner {
+			continue
+		}
+		err = insertMatch(tx, Match{
+			Time:   at,
+			Kind:   MatchGame,
+			Winner: over.Winner,
+			Loser:  standing.Username,
+			Detail: over.Reason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) Leaderboard(limit int) ([]Rating, error) {
+	rows, err := s.db.Query(`
+		SELECT username, rating, wars_won, wars_lost, wars_drawn,
+			units_destroyed, units_lost, games_won, games_played
+		FROM players
+		ORDER BY rating DESC, username
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query leaderboard: %v", err)
+	}
+	defer rows.Close()
+
+	ratings := []Rating{}
+	for rows.Next() {
+		var r Rating
+		err = rows.Scan(&r.Username, &r.Rating, &r.WarsWon, &r.WarsLost, &r.WarsDrawn,
+			&r.UnitsDestroyed, &r.UnitsLost, &r.GamesWon, &r.GamesPlayed)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan rating: %v", err)
+		}
+		ratings = append(ratings, r)
+	}
+	return ratings, rows.Err()
+}
+
+func (s *Store) History(username string, limit int) ([]Match, error) {
+	rows, err := s.db.Query(`
+		SELECT id, time, kind, winner, loser, draw, location, detail
+		FROM matches
+		WHERE winner = ? OR loser = ?
+		ORDER BY id DESC
+		LIMIT ?`, username, username, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query history: %v", err)
+	}
+	defer rows.Close()
+
+	matches := []Match{}
+	for rows.Next() {
+		var m Match
+		var unix int64
+		err = rows.Scan(&m.ID, &unix, &m.Kind, &m.Winner, &m.Loser, &m.Draw, &m.Location, &m.Detail)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan match: %v", err)
+		}
+		m.Time = time.Unix(unix, 0)
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+func getRating(tx *sql.Tx, username string) (Rating, error) {
+	r := Rating{Username: username}
+	err := tx.QueryRow(`
+		SELECT rating, wars_won, wars_lost, wars_drawn,
+			units_destroyed, units_lost, games_won, games_played
+		FROM players WHERE username = ?`, username).Scan(
+		&r.Rating, &r.WarsWon, &r.WarsLost, &r.WarsDrawn,
+		&r.UnitsDestroyed, &r.UnitsLost, &r.GamesWon, &r.GamesPlayed)
+	if err == sql.ErrNoRows {
+		r.Rating = initialRating
+		return r, nil
+	}
+	if err != nil {
+		return Rating{}, fmt.Errorf("Failed to get rating: %v", err)
+	}
+	return r, nil
+}
+
+func putRating(tx *sql.Tx, r Rating) error {
+	_, err := tx.Exec(`
+		INSERT INTO players (username, rating, wars_won, wars_lost, wars_drawn,
+			units_destroyed, units_lost, games_won, games_played)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(username) DO UPDATE SET
+			rating = excluded.rating,
+			wars_won = excluded.wars_won,
+			wars_lost = excluded.wars_lost,
+			wars_drawn = excluded.wars_drawn,
+			units_destroyed = excluded.units_destroyed,
+			units_lost = excluded.units_lost,
+			games_won = excluded.games_won,
+			games_played = excluded.games_played`,
+		r.Username, r.Rating, r.WarsWon, r.WarsLost, r.WarsDrawn,
+		r.UnitsDestroyed, r.UnitsLost, r.GamesWon, r.GamesPlayed)
+	if err != nil {
+		return fmt.Errorf("Failed to save rating: %v", err)
+	}
+	return nil
+}
+
+func insertMatch(tx *sql.Tx, m Match) error {
+	_, err := tx.Exec(`
+		INSERT INTO matches (time, kind, winner, loser, draw, location, detail)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		m.Time.Unix(), m.Kind, m.Winner, m.Loser, m.Draw, m.Location, m.Detail)
+	if err != nil {
+		return fmt.Errorf("Failed to save match: %v", err)
+	}
+	return nil
+}
+
+// updateRatings applies an Elo update where score is a's result against b:
+// 1 for a win, 0.5 for a draw.
+func updateRatings(a, b int, score float64) (int, int) {
+	expected := 1 / (1 + math.Pow(10, float64(b-a)/400))
+	delta := int(math.Round(ratingK * (score - expected)))
+	return a + delta, b - delta
+}
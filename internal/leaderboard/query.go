@@ -0,0 +1,75 @@
+package leaderboard
+
+import (
+	"fmt"
+	"time"
+)
+
+type QueryKind string
+
+const (
+	QueryLeaderboard QueryKind = "leaderboard"
+	QueryHistory     QueryKind = "history"
+)
+
+type Query struct {
+	Kind     QueryKind
+	Username string
+	Limit    int
+}
+
+type Response struct {
+	Ratings []Rating
+	Matches []Match
+	Error   string
+}
+
+// Answer runs a query against the store, folding any error into the
+// response so it can be returned to the caller.
+func (s *Store) Answer(q Query) Response {
+	var resp Response
+	var err error
+	switch q.Kind {
+	case QueryLeaderboard:
+		resp.Ratings, err = s.Leaderboard(q.Limit)
+	case QueryHistory:
+		resp.Matches, err = s.History(q.Username, q.Limit)
+	default:
+		err = fmt.Errorf("unknown query: %s", q.Kind)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+func PrintRatings(ratings []Rating) {
+	if len(ratings) == 0 {
+		fmt.Println("No results have been recorded yet.")
+		return
+	}
+	fmt.Println("Leaderboard:")
+	for i, r := range ratings {
+		fmt.Printf("%d. %s (%d): wars %d-%d-%d, units destroyed %d, lost %d, games won %d/%d\n",
+			i+1, r.Username, r.Rating, r.WarsWon, r.WarsLost, r.WarsDrawn,
+			r.UnitsDestroyed, r.UnitsLost, r.GamesWon, r.GamesPlayed)
+	}
+}
+
+func PrintHistory(username string, matches []Match) {
+	if len(matches) == 0 {
+		fmt.Printf("No history for %s.\n", username)
+		return
+	}
+	fmt.Printf("History for %s:\n", username)
+	for _, m := range matches {
+		result := fmt.Sprintf("%s beat %s", m.Winner, m.Loser)
+		if m.Draw {
+			result = fmt.Sprintf("%s drew with %s", m.Winner, m.Loser)
+		}
+		if m.Location != "" {
+			result = fmt.Sprintf("%s in %s", result, m.Location)
+		}
+		fmt.Printf("* %v [%s] %s: %s\n", m.Time.Format(time.RFC3339), m.Kind, result, m.Detail)
+	}
+}
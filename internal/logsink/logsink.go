@@ -0,0 +1,194 @@
+package logsink
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// LogSink is somewhere game logs are stored.
+type LogSink interface {
+	Write(gl routing.GameLog) error
+	Flush() error
+	Close() error
+}
+
+// RetryOptions control how a Fanout retries a failing sink, and how long a
+// write waits for room in a sink's queue before failing.
+type RetryOptions struct {
+	Attempts  int
+	Backoff   time.Duration
+	QueueSize int
+	QueueWait time.Duration
+}
+
+// Fanout writes every log to several sinks. Each sink has its own queue and
+// goroutine, so a slow or failing sink never holds up the others.
+type Fanout struct {
+	workers []*sinkWorker
+	wg      *sync.WaitGroup
+	closed  bool
+	mu      *sync.RWMutex
+}
+
+// ErrClosed is returned when writing to a Fanout that has been closed.
+var ErrClosed = errors.New("log sinks are closed")
+
+type sinkWorker struct {
+	name  string
+	sink  LogSink
+	queue chan sinkJob
+	opts  RetryOptions
+}
+
+// sinkJob is either a log to write or, when flushed is set, a request to
+// flush the sink once everything queued before it has been written.
+type sinkJob struct {
+	gl      routing.GameLog
+	flushed chan error
+}
+
+func NewFanout(sinks map[string]LogSink, opts RetryOptions) *Fanout {
+	if opts.Attempts < 1 {
+		opts.Attempts = 1
+	}
+
+	f := &Fanout{wg: &sync.WaitGroup{}, mu: &sync.RWMutex{}}
+	for name, sink := range sinks {
+		w := &sinkWorker{
+			name:  name,
+			sink:  sink,
+			queue: make(chan sinkJob, opts.QueueSize),
+			opts:  opts,
+		}
+		f.workers = append(f.workers, w)
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			w.run()
+		}()
+	}
+	return f
+}
+
+// Write queues gl for every sink. When a sink has fallen so far behind that
+// its queue stays full for QueueWait, the write fails so the log can be
+// redelivered, even though the sinks that kept up will then see it twice.
+func (f *Fanout) Write(gl routing.GameLog) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closed {
+		return ErrClosed
+	}
+	errs := []string{}
+	for _, w := range f.workers {
+		err := w.enqueue(gl)
+		if err != nil {
+			logsRefused.WithLabelValues(w.name).Inc()
+			errs = append(errs, fmt.Sprintf("%s: %v", w.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("could not queue log: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Flush waits for every sink to write what was queued before it, then
+// flushes them.
+func (f *Fanout) Flush() error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closed {
+		return ErrClosed
+	}
+	flushes := make([]chan error, len(f.workers))
+	for i, w := range f.workers {
+		flushes[i] = make(chan error, 1)
+		w.queue <- sinkJob{flushed: flushes[i]}
+	}
+	errs := []string{}
+	for i, w := range f.workers {
+		err := <-flushes[i]
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", w.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("could not flush sinks: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Close waits for every queued log to be written, then closes the sinks.
+// Writes after that fail with ErrClosed.
+func (f *Fanout) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return ErrClosed
+	}
+	f.closed = true
+	for _, w := range f.workers {
+		close(w.queue)
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+
+	errs := []string{}
+	for _, w := range f.workers {
+		err := w.sink.Close()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", w.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("could not close sinks: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (w *sinkWorker) enqueue(gl routing.GameLog) error {
+	select {
+	case w.queue <- sinkJob{gl: gl}:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(w.opts.QueueWait)
+	defer timer.Stop()
+	select {
+	case w.queue <- sinkJob{gl: gl}:
+		return nil
+	case <-timer.C:
+		return errors.New("queue is full")
+	}
+}
+
+func (w *sinkWorker) run() {
+	for job := range w.queue {
+		if job.flushed != nil {
+			job.flushed <- w.sink.Flush()
+			continue
+		}
+
+		var err error
+		for attempt := 1; attempt <= w.opts.Attempts; attempt++ {
+			err = w.sink.Write(job.gl)
+			if err == nil {
+				break
+			}
+			if attempt < w.opts.Attempts {
+				time.Sleep(w.opts.Backoff * time.Duration(attempt))
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to write log to %s after %d attempt(s): %v", w.name, w.opts.Attempts, err)
+		}
+	}
+}
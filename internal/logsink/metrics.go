@@ -0,0 +1,11 @@
+package logsink
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var logsRefused = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "peril_logsink_refused_total",
+	Help: "Game logs refused because a sink's queue stayed full, by sink.",
+}, []string{"sink"})
@@ -0,0 +1,142 @@
+package logsink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Filter selects game logs. Zero values match everything.
+type Filter struct {
+	Username string
+	Since    time.Time
+	Until    time.Time
+	Text     string
+	Limit    int
+}
+
+func (f Filter) matches(gl routing.GameLog) bool {
+	if f.Username != "" && gl.Username != f.Username {
+		return false
+	}
+	if !f.Since.IsZero() && gl.CurrentTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && gl.CurrentTime.After(f.Until) {
+		return false
+	}
+	if f.Text != "" && !strings.Contains(strings.ToLower(gl.Message), strings.ToLower(f.Text)) {
+		return false
+	}
+	return true
+}
+
+// Query searches the log at path and its rotated files, returning the most
+// recent matches in chronological order.
+func Query(path string, f Filter) ([]routing.GameLog, error) {
+	ext := filepath.Ext(path)
+	rotated, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-*" + ext + "*")
+	if err != nil {
+		return nil, fmt.Errorf("could not list rotated logs: %v", err)
+	}
+	sort.Strings(rotated)
+
+	logs := []routing.GameLog{}
+	for _, p := range append(rotated, path) {
+		err = scanFile(p, func(gl routing.GameLog) {
+			if f.matches(gl) {
+				logs = append(logs, gl)
+			}
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if f.Limit > 0 && len(logs) > f.Limit {
+		logs = logs[len(logs)-f.Limit:]
+	}
+	return logs, nil
+}
+
+func scanFile(path string, fn func(routing.GameLog)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("could not decompress %s: %v", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var e entry
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			// Skip lines that aren't JSON, such as plain text from older logs
+			continue
+		}
+		fn(routing.GameLog{CurrentTime: e.Time, Username: e.Username, Message: e.Message})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read %s: %v", path, err)
+	}
+	return nil
+}
+
+// ParseFilter reads key=value words: user, since, until, text and limit.
+// Times are RFC 3339 or a duration before now, such as 15m.
+func ParseFilter(words []string, now time.Time) (Filter, error) {
+	var f Filter
+	for _, word := range words {
+		key, value, ok := strings.Cut(word, "=")
+		if !ok {
+			return Filter{}, fmt.Errorf("expected key=value, got %q", word)
+		}
+
+		var err error
+		switch key {
+		case "user":
+			f.Username = value
+		case "since":
+			f.Since, err = parseTime(value, now)
+		case "until":
+			f.Until, err = parseTime(value, now)
+		case "text":
+			f.Text = value
+		case "limit":
+			_, err = fmt.Sscanf(value, "%d", &f.Limit)
+		default:
+			err = fmt.Errorf("unknown filter %q", key)
+		}
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	return f, nil
+}
+
+func parseTime(s string, now time.Time) (time.Time, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,228 @@
+package logsink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Options configure a RotatingFile. Zero values disable the corresponding
+// behaviour.
+type Options struct {
+	Path string
+
+	// MaxBytes and MaxAge trigger a rotation once the current file grows
+	// past them.
+	MaxBytes int64
+	MaxAge   time.Duration
+
+	// Compress gzips rotated files.
+	Compress bool
+
+	// FlushInterval bounds how long entries sit in the buffer.
+	FlushInterval time.Duration
+
+	// Latency simulates a slow disk by sleeping before each write.
+	Latency time.Duration
+}
+
+type entry struct {
+	Time     time.Time `json:"time"`
+	Username string    `json:"username"`
+	Message  string    `json:"message"`
+}
+
+// RotatingFile writes game logs as JSON Lines through a buffer, rotating
+// the file by size and age.
+type RotatingFile struct {
+	opts   Options
+	f      *os.File
+	w      *bufio.Writer
+	size   int64
+	opened time.Time
+	done   chan struct{}
+	mu     *sync.Mutex
+}
+
+func NewRotatingFile(opts Options) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		opts: opts,
+		done: make(chan struct{}),
+		mu:   &sync.Mutex{},
+	}
+	err := rf.open()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.FlushInterval > 0 {
+		go rf.flushLoop()
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) Write(gl routing.GameLog) error {
+	if rf.opts.Latency > 0 {
+		time.Sleep(rf.opts.Latency)
+	}
+
+	data, err := json.Marshal(entry{Time: gl.CurrentTime, Username: gl.Username, Message: gl.Message})
+	if err != nil {
+		return fmt.Errorf("could not encode log: %v", err)
+	}
+	data = append(data, '\n')
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.shouldRotate(int64(len(data))) {
+		err = rf.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := rf.w.Write(data)
+	rf.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("could not write to logs file: %v", err)
+	}
+	return nil
+}
+
+func (rf *RotatingFile) Flush() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.w.Flush()
+}
+
+func (rf *RotatingFile) Close() error {
+	close(rf.done)
+
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	err := rf.w.Flush()
+	if err != nil {
+		rf.f.Close()
+		return fmt.Errorf("could not flush logs file: %v", err)
+	}
+	return rf.f.Close()
+}
+
+func (rf *RotatingFile) flushLoop() {
+	ticker := time.NewTicker(rf.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := rf.Flush()
+			if err != nil {
+				log.Printf("Failed to flush logs: %v", err)
+			}
+		case <-rf.done:
+			return
+		}
+	}
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.opts.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not stat logs file: %v", err)
+	}
+
+	rf.f = f
+	rf.w = bufio.NewWriter(f)
+	rf.size = info.Size()
+	rf.opened = time.Now()
+	return nil
+}
+
+func (rf *RotatingFile) shouldRotate(next int64) bool {
+	if rf.size == 0 {
+		return false
+	}
+	if rf.opts.MaxBytes > 0 && rf.size+next > rf.opts.MaxBytes {
+		return true
+	}
+	return rf.opts.MaxAge > 0 && time.Since(rf.opened) > rf.opts.MaxAge
+}
+
+// rotate moves the current file aside and starts a new one. Callers must
+// hold rf.mu.
+func (rf *RotatingFile) rotate() error {
+	err := rf.w.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush logs file: %v", err)
+	}
+	err = rf.f.Close()
+	if err != nil {
+		return fmt.Errorf("could not close logs file: %v", err)
+	}
+
+	rotated := rotatedPath(rf.opts.Path, time.Now())
+	err = os.Rename(rf.opts.Path, rotated)
+	if err != nil {
+		return fmt.Errorf("could not rotate logs file: %v", err)
+	}
+	if rf.opts.Compress {
+		err = compressFile(rotated)
+		if err != nil {
+			log.Printf("Failed to compress %s: %v", rotated, err)
+		}
+	}
+
+	return rf.open()
+}
+
+// rotatedPath turns game.jsonl into game-20060102T150405.000.jsonl, which
+// sorts in rotation order.
+func rotatedPath(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.UTC().Format("20060102T150405.000"), ext)
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	err = zw.Close()
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	err = dst.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
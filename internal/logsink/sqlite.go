@@ -0,0 +1,56 @@
+package logsink
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	_ "modernc.org/sqlite"
+)
+
+// SQLite stores game logs in a table that can be queried with SQL.
+type SQLite struct {
+	db *sql.DB
+}
+
+func NewSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS game_logs (
+			id       INTEGER PRIMARY KEY AUTOINCREMENT,
+			time     INTEGER NOT NULL,
+			username TEXT NOT NULL,
+			message  TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS game_logs_username ON game_logs (username, time);`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create schema: %v", err)
+	}
+
+	return &SQLite{db: db}, nil
+}
+
+func (s *SQLite) Write(gl routing.GameLog) error {
+	_, err := s.db.Exec(
+		`INSERT INTO game_logs (time, username, message) VALUES (?, ?, ?)`,
+		gl.CurrentTime.UnixNano(), gl.Username, gl.Message,
+	)
+	if err != nil {
+		return fmt.Errorf("could not insert log: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLite) Flush() error {
+	return nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,35 @@
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Stdout prints game logs as plain text lines.
+type Stdout struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func NewStdout(w io.Writer) *Stdout {
+	return &Stdout{w: w, mu: &sync.Mutex{}}
+}
+
+func (s *Stdout) Write(gl routing.GameLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.w, "%v %v: %v\n", gl.CurrentTime.Format(time.RFC3339), gl.Username, gl.Message)
+	return err
+}
+
+func (s *Stdout) Flush() error {
+	return nil
+}
+
+func (s *Stdout) Close() error {
+	return nil
+}
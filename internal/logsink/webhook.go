@@ -0,0 +1,48 @@
+package logsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Webhook POSTs each game log as JSON to a URL.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string, client *http.Client) *Webhook {
+	return &Webhook{url: url, client: client}
+}
+
+func (wh *Webhook) Write(gl routing.GameLog) error {
+	body, err := json.Marshal(entry{Time: gl.CurrentTime, Username: gl.Username, Message: gl.Message})
+	if err != nil {
+		return fmt.Errorf("could not encode log: %v", err)
+	}
+
+	resp, err := wh.client.Post(wh.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not post log: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (wh *Webhook) Flush() error {
+	return nil
+}
+
+func (wh *Webhook) Close() error {
+	return nil
+}
@@ -0,0 +1,199 @@
+package logsink
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func TestWebhookPostsLogAsJSON(t *testing.T) {
+	var got entry
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		contentType = r.Header.Get("Content-Type")
+		err := json.NewDecoder(r.Body).Decode(&got)
+		if err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	wh := NewWebhook(srv.URL, srv.Client())
+	err := wh.Write(routing.GameLog{CurrentTime: now, Username: "alice", Message: "hello"})
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	want := entry{Time: now, Username: "alice", Message: "hello"}
+	if !got.Time.Equal(want.Time) || got.Username != want.Username || got.Message != want.Message {
+		t.Errorf("posted %+v, want %+v", got, want)
+	}
+}
+
+func TestWebhookFailsOnErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	wh := NewWebhook(srv.URL, srv.Client())
+	err := wh.Write(routing.GameLog{Username: "alice", Message: "hello"})
+	if err == nil {
+		t.Fatal("Write succeeded, want an error for a 500 response")
+	}
+}
+
+func TestWebhookFailsWhenUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	wh := NewWebhook(url, http.DefaultClient)
+	err := wh.Write(routing.GameLog{Username: "alice", Message: "hello"})
+	if err == nil {
+		t.Fatal("Write succeeded, want an error for a closed server")
+	}
+}
+
+func TestFanoutRetriesWebhook(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	f := NewFanout(
+		map[string]LogSink{"webhook": NewWebhook(srv.URL, srv.Client())},
+		RetryOptions{Attempts: 2, QueueSize: 1},
+	)
+	err := f.Write(routing.GameLog{Username: "alice", Message: "hello"})
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 2 {
+		t.Errorf("webhook called %d times, want 2", calls)
+	}
+}
+
+func TestFanoutFailsWhenASinkIsFull(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	posted := 0
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		posted++
+	}))
+	defer fast.Close()
+
+	f := NewFanout(map[string]LogSink{
+		"slow": NewWebhook(slow.URL, slow.Client()),
+		"fast": NewWebhook(fast.URL, fast.Client()),
+	}, RetryOptions{QueueSize: 1, QueueWait: 50 * time.Millisecond})
+
+	// The slow sink holds one log in flight and one in its queue, so the
+	// third write fails for it but still reaches the fast sink
+	for i := range 3 {
+		err := f.Write(routing.GameLog{Username: "alice", Message: "hello"})
+		if i < 2 && err != nil {
+			t.Fatalf("Write %d: %v", i+1, err)
+		}
+		if i == 2 && err == nil {
+			t.Fatal("Write succeeded with the slow sink's queue full")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	err := f.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if posted != 3 {
+		t.Errorf("fast sink got %d logs, want 3", posted)
+	}
+}
+
+func TestFanoutFlushWaitsForQueuedLogs(t *testing.T) {
+	var mu sync.Mutex
+	posted := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		posted++
+	}))
+	defer srv.Close()
+
+	f := NewFanout(map[string]LogSink{"webhook": NewWebhook(srv.URL, srv.Client())}, RetryOptions{QueueSize: 5})
+	defer f.Close()
+	for range 5 {
+		err := f.Write(routing.GameLog{Username: "alice", Message: "hello"})
+		if err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	err := f.Flush()
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if posted != 5 {
+		t.Errorf("webhook got %d logs by the time Flush returned, want 5", posted)
+	}
+}
+
+func TestFanoutFailsAfterClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	f := NewFanout(map[string]LogSink{"webhook": NewWebhook(srv.URL, srv.Client())}, RetryOptions{QueueSize: 1})
+	err := f.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	err = f.Write(routing.GameLog{Username: "alice", Message: "too late"})
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Write after Close = %v, want ErrClosed", err)
+	}
+	err = f.Close()
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("second Close = %v, want ErrClosed", err)
+	}
+}
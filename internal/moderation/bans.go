@@ -0,0 +1,129 @@
+package moderation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Ban struct {
+	Username string
+	Reason   string
+	Since    time.Time
+
+	// Until is when the ban expires. A zero Until never expires.
+	Until time.Time
+}
+
+func (b Ban) Permanent() bool {
+	return b.Until.IsZero()
+}
+
+func (b Ban) activeAt(now time.Time) bool {
+	return b.Permanent() || now.Before(b.Until)
+}
+
+// Bans is a list of banned players saved to a file on every change, so
+// bans outlive the server.
+type Bans struct {
+	path string
+	bans map[string]Ban
+	mu   *sync.Mutex
+}
+
+func LoadBans(path string) (*Bans, error) {
+	b := &Bans{path: path, bans: map[string]Ban{}, mu: &sync.Mutex{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read bans: %v", err)
+	}
+
+	bans := []Ban{}
+	err = json.Unmarshal(data, &bans)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode bans: %v", err)
+	}
+	for _, ban := range bans {
+		b.bans[ban.Username] = ban
+	}
+	return b, nil
+}
+
+func (b *Bans) Ban(ban Ban) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bans[ban.Username] = ban
+	return b.save()
+}
+
+// Unban lifts a ban, reporting whether the player was banned.
+func (b *Bans) Unban(username string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.bans[username]; !ok {
+		return false, nil
+	}
+	delete(b.bans, username)
+	return true, b.save()
+}
+
+func (b *Bans) IsBanned(username string, now time.Time) (Ban, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ban, ok := b.bans[username]
+	if !ok || !ban.activeAt(now) {
+		return Ban{}, false
+	}
+	return ban, true
+}
+
+// List returns the bans still in effect.
+func (b *Bans) List(now time.Time) []Ban {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bans := []Ban{}
+	for _, ban := range b.bans {
+		if ban.activeAt(now) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Username < bans[j].Username
+	})
+	return bans
+}
+
+// save writes every ban to disk. Callers must hold b.mu.
+func (b *Bans) save() error {
+	bans := []Ban{}
+	for _, ban := range b.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Username < bans[j].Username
+	})
+
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode bans: %v", err)
+	}
+
+	tmp := b.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write bans: %v", err)
+	}
+	err = os.Rename(tmp, b.path)
+	if err != nil {
+		return fmt.Errorf("could not write bans: %v", err)
+	}
+	return nil
+}
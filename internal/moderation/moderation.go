@@ -0,0 +1,140 @@
+package moderation
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/ratelimit"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+type Verdict int
+
+const (
+	Allow Verdict = iota
+	Reject
+	Muted
+)
+
+// Options configure a Moderator.
+type Options struct {
+	Rate  float64
+	Burst int
+
+	MaxLength int
+	MaxSkew   time.Duration
+
+	// A player who breaks the rules Strikes times within StrikeWindow is
+	// muted for MuteFor.
+	Strikes      int
+	StrikeWindow time.Duration
+	MuteFor      time.Duration
+}
+
+// Moderator decides whether a player's game logs should be accepted,
+// muting players who keep breaking the rules.
+type Moderator struct {
+	opts    Options
+	limiter *ratelimit.Limiter
+	strikes map[string][]time.Time
+	muted   map[string]time.Time
+	audit   func(routing.GameLog)
+	mu      *sync.Mutex
+}
+
+// NewModerator creates a Moderator that reports every mute to audit.
+func NewModerator(opts Options, audit func(routing.GameLog)) *Moderator {
+	return &Moderator{
+		opts:    opts,
+		limiter: ratelimit.NewLimiter(opts.Rate, opts.Burst),
+		strikes: map[string][]time.Time{},
+		muted:   map[string]time.Time{},
+		audit:   audit,
+		mu:      &sync.Mutex{},
+	}
+}
+
+// Check validates a game log submitted with routingKey, returning why it
+// was rejected if it was.
+func (m *Moderator) Check(gl routing.GameLog, routingKey string, now time.Time) (Verdict, string) {
+	username := strings.TrimPrefix(routingKey, routing.GameLogSubmitPrefix+".")
+	if until, ok := m.mutedUntil(username, now); ok {
+		return Muted, fmt.Sprintf("%s is muted until %v", username, until.Format(time.RFC3339))
+	}
+
+	reason := m.validate(gl, username, now)
+	if reason == "" && !m.limiter.Allow(username, now) {
+		reason = "sending game logs too quickly"
+	}
+	if reason == "" {
+		return Allow, ""
+	}
+
+	if m.strike(username, now) {
+		m.audit(routing.GameLog{
+			CurrentTime: now,
+			Username:    username,
+			Message:     fmt.Sprintf("[audit] %s muted for %v after %d violations, last: %s", username, m.opts.MuteFor, m.opts.Strikes, reason),
+		})
+	}
+	return Reject, reason
+}
+
+func (m *Moderator) Unmute(username string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.muted, username)
+	delete(m.strikes, username)
+}
+
+func (m *Moderator) validate(gl routing.GameLog, username string, now time.Time) string {
+	switch {
+	case gl.Username != username:
+		return fmt.Sprintf("username %q does not match routing key", gl.Username)
+	case strings.TrimSpace(gl.Message) == "":
+		return "message is empty"
+	case m.opts.MaxLength > 0 && len(gl.Message) > m.opts.MaxLength:
+		return fmt.Sprintf("message is longer than %d characters", m.opts.MaxLength)
+	case m.opts.MaxSkew > 0 && (gl.CurrentTime.Before(now.Add(-m.opts.MaxSkew)) || gl.CurrentTime.After(now.Add(m.opts.MaxSkew))):
+		return fmt.Sprintf("timestamp %v is more than %v from server time", gl.CurrentTime.Format(time.RFC3339), m.opts.MaxSkew)
+	}
+	return ""
+}
+
+func (m *Moderator) mutedUntil(username string, now time.Time) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	until, ok := m.muted[username]
+	if !ok {
+		return time.Time{}, false
+	}
+	if now.After(until) {
+		delete(m.muted, username)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// strike records a violation, reporting whether it got the player muted.
+func (m *Moderator) strike(username string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recent := []time.Time{}
+	for _, t := range m.strikes[username] {
+		if now.Sub(t) < m.opts.StrikeWindow {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	m.strikes[username] = recent
+
+	if m.opts.Strikes <= 0 || len(recent) < m.opts.Strikes {
+		return false
+	}
+	m.muted[username] = now.Add(m.opts.MuteFor)
+	delete(m.strikes, username)
+	return true
+}
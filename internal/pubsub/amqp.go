@@ -0,0 +1,458 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	ampq "github.com/rabbitmq/amqp091-go"
+)
+
+// replyToQueue is RabbitMQ's direct reply-to pseudo-queue, which lets a
+// caller receive responses without declaring a queue of its own.
+const replyToQueue = "amq.rabbitmq.reply-to"
+
+// AMQPTransport runs Peril on RabbitMQ. When its connection drops it
+// reconnects to the next node and declares and consumes every queue again.
+type AMQPTransport struct {
+	opts DialOptions
+	pool *brokerPool
+	dial func(url string) (amqpConnection, error)
+
+	conn amqpConnection
+	ch   *ampq.Channel
+
+	// subs set up each subscription on a connection, and are run again
+	// on every new one
+	subs     []func(conn amqpConnection) error
+	inflight *inflight
+	closed   bool
+	mu       *sync.Mutex
+}
+
+// amqpConnection is the part of *ampq.Connection the transport uses, so
+// tests can dial stand-ins for the nodes of a cluster.
+type amqpConnection interface {
+	Channel() (*ampq.Channel, error)
+	NotifyClose(receiver chan *ampq.Error) chan *ampq.Error
+	Close() error
+}
+
+// DialAMQP connects over TLS for amqps:// URLs, verifying the broker
+// against the system's roots unless opts.TLS says otherwise.
+func DialAMQP(opts DialOptions) (*AMQPTransport, error) {
+	opts = opts.withDefaults()
+	for _, url := range opts.URLs {
+		err := opts.checkAuth(url)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+	cfg := ampq.Config{
+		Vhost:           opts.VHost,
+		TLSClientConfig: tlsConfig,
+		Locale:          "en_US",
+	}
+	if opts.Auth == AuthExternal {
+		cfg.SASL = []ampq.Authentication{&ampq.ExternalAuth{}}
+	} else if opts.Username != "" {
+		cfg.SASL = []ampq.Authentication{&ampq.PlainAuth{Username: opts.Username, Password: opts.Password}}
+	}
+
+	return newAMQPTransport(opts, func(url string) (amqpConnection, error) {
+		cfg := cfg
+		if cfg.TLSClientConfig != nil {
+			// The client fills in the server name from the URL
+			cfg.TLSClientConfig = cfg.TLSClientConfig.Clone()
+		}
+		conn, err := ampq.DialConfig(url, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	})
+}
+
+// newAMQPTransport connects to the first node in opts.URLs that dial can
+// reach.
+func newAMQPTransport(opts DialOptions, dial func(url string) (amqpConnection, error)) (*AMQPTransport, error) {
+	t := &AMQPTransport{
+		opts:     opts,
+		pool:     newBrokerPool(opts),
+		dial:     dial,
+		inflight: newInflight(),
+		mu:       &sync.Mutex{},
+	}
+	err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// connect tries each node in turn, then resubscribes on the first one that
+// accepts the connection.
+func (t *AMQPTransport) connect() error {
+	var errs []error
+	for _, url := range t.pool.order() {
+		conn, err := t.dial(url)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			errs = append(errs, fmt.Errorf("Failed to create channel: %v", err))
+			continue
+		}
+		closes := conn.NotifyClose(make(chan *ampq.Error, 1))
+
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		t.pool.connected(url)
+		t.conn = conn
+		t.ch = ch
+		for _, sub := range t.subs {
+			err := sub(conn)
+			if err != nil {
+				log.Printf("Failed to resubscribe: %v", err)
+			}
+		}
+		t.mu.Unlock()
+
+		go t.reconnect(closes)
+		return nil
+	}
+	return fmt.Errorf("Failed to connect to rabbitmq: %v", errors.Join(errs...))
+}
+
+// reconnect waits for the connection to drop, then connects again, backing
+// off while no node is reachable.
+func (t *AMQPTransport) reconnect(closes <-chan *ampq.Error) {
+	err := <-closes
+	if t.isClosed() {
+		return
+	}
+	log.Printf("Lost connection to rabbitmq: %v", err)
+
+	backoff := reconnectMinBackoff
+	for {
+		err := t.connect()
+		if t.isClosed() {
+			return
+		}
+		if err == nil {
+			reconnects.WithLabelValues("amqp").Inc()
+			log.Printf("Reconnected to rabbitmq")
+			return
+		}
+		log.Printf("Failed to reconnect, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+func (t *AMQPTransport) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+// subscribe runs sub on the current connection, and keeps it to run again
+// after reconnecting.
+func (t *AMQPTransport) subscribe(sub func(conn amqpConnection) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := sub(t.conn)
+	if err != nil {
+		return err
+	}
+	t.subs = append(t.subs, sub)
+	return nil
+}
+
+func (t *AMQPTransport) Drain(timeout time.Duration) error {
+	return t.inflight.drain(timeout)
+}
+
+func (t *AMQPTransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	conn := t.conn
+	t.mu.Unlock()
+
+	err := conn.Close()
+	if errors.Is(err, ampq.ErrClosed) {
+		// Lost while reconnecting
+		return nil
+	}
+	return err
+}
+
+func (t *AMQPTransport) Publish(exchange, key string, msg Message) error {
+	t.mu.Lock()
+	ch := t.ch
+	t.mu.Unlock()
+
+	return ch.PublishWithContext(
+		context.Background(),
+		exchange,
+		key,
+		false,
+		false,
+		ampq.Publishing{
+			ContentType: msg.ContentType,
+			Body:        msg.Body,
+		},
+	)
+}
+
+func (t *AMQPTransport) Subscribe(exchange, queueName, key string, cfg QueueConfig, handler func(Message) AckType) error {
+	return t.subscribe(func(conn amqpConnection) error {
+		return t.consume(conn, exchange, queueName, key, cfg, nil, t.opts.Workers, func(d ampq.Delivery) AckType {
+			return handler(amqpMessage(d))
+		})
+	})
+}
+
+// SubscribeStream picks up after the last message handled when it
+// resubscribes, rather than starting from offset again.
+func (t *AMQPTransport) SubscribeStream(exchange, streamName, key string, offset StreamOffset, handler func(Message) AckType) error {
+	next := offset.value
+	mu := &sync.Mutex{}
+	return t.subscribe(func(conn amqpConnection) error {
+		mu.Lock()
+		start := next
+		mu.Unlock()
+
+		return t.consume(
+			conn,
+			exchange,
+			streamName,
+			key,
+			NewQueueConfig(Stream),
+			ampq.Table{"x-stream-offset": start},
+			1,
+			func(d ampq.Delivery) AckType {
+				ack := handler(amqpMessage(d))
+				if o, ok := d.Headers["x-stream-offset"].(int64); ok {
+					mu.Lock()
+					next = o + 1
+					mu.Unlock()
+				}
+				return ack
+			},
+		)
+	})
+}
+
+// DeclareStream declares the stream again after reconnecting, in case the
+// node we move to doesn't have it.
+func (t *AMQPTransport) DeclareStream(exchange, streamName, key string) error {
+	return t.subscribe(func(conn amqpConnection) error {
+		ch, _, err := declareAndBind(conn, exchange, streamName, key, NewQueueConfig(Stream))
+		if err != nil {
+			return err
+		}
+		return ch.Close()
+	})
+}
+
+func (t *AMQPTransport) consume(
+	conn amqpConnection,
+	exchange string,
+	queueName string,
+	key string,
+	cfg QueueConfig,
+	consumeArgs ampq.Table,
+	workers int,
+	handler func(ampq.Delivery) AckType,
+) error {
+	ch, q, err := declareAndBind(conn, exchange, queueName, key, cfg)
+	if err != nil {
+		return fmt.Errorf("Failed to declare and bind: %v", err)
+	}
+
+	err = ch.Qos(t.opts.Prefetch, 0, false)
+	if err != nil {
+		return fmt.Errorf("Failed to set prefetch size: %v\n", err)
+	}
+
+	ds, err := ch.Consume(q.Name, "", false, false, false, false, consumeArgs)
+	if err != nil {
+		return fmt.Errorf("Failed to consume queue: %v", err)
+	}
+
+	for range workers {
+		go t.handleDeliveries(ds, handler)
+	}
+
+	return nil
+}
+
+func (t *AMQPTransport) handleDeliveries(ds <-chan ampq.Delivery, handler func(ampq.Delivery) AckType) {
+	for d := range ds {
+		if !t.inflight.start() {
+			return
+		}
+		ackDelivery(d, handler(d))
+		t.inflight.done()
+	}
+}
+
+func ackDelivery(d ampq.Delivery, ack AckType) {
+	var err error
+	switch ack {
+	case Ack:
+		err = d.Ack(false)
+		if err != nil {
+			log.Printf("Failed to ack delivery: %v", err)
+		}
+
+	case NackRequeue:
+		err = d.Nack(false, true)
+		if err != nil {
+			log.Printf("Failed to nack delivery: %v", err)
+		}
+
+	case NackDiscard:
+		err = d.Nack(false, false)
+		if err != nil {
+			log.Printf("Failed to nack delivery: %v", err)
+		}
+	}
+}
+
+func amqpMessage(d ampq.Delivery) Message {
+	return Message{
+		ContentType: d.ContentType,
+		Body:        d.Body,
+		RoutingKey:  d.RoutingKey,
+	}
+}
+
+func (t *AMQPTransport) Serve(exchange, queueName, key string, handler func(Message) (Message, error)) error {
+	return t.subscribe(func(conn amqpConnection) error {
+		return t.serve(conn, exchange, queueName, key, handler)
+	})
+}
+
+func (t *AMQPTransport) serve(conn amqpConnection, exchange, queueName, key string, handler func(Message) (Message, error)) error {
+	ch, _, err := declareAndBind(conn, exchange, queueName, key, NewQueueConfig(Durable))
+	if err != nil {
+		return fmt.Errorf("Failed to declare and bind: %v", err)
+	}
+
+	ds, err := ch.Consume(queueName, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to consume queue: %v", err)
+	}
+
+	go func() {
+		for d := range ds {
+			if !t.inflight.start() {
+				return
+			}
+			answer(ch, d, handler)
+			t.inflight.done()
+		}
+	}()
+
+	return nil
+}
+
+func answer(ch *ampq.Channel, d ampq.Delivery, handler func(Message) (Message, error)) {
+	resp, err := handler(amqpMessage(d))
+	if err != nil {
+		log.Printf("Failed to handle request: %v", err)
+		d.Nack(false, false)
+		return
+	}
+
+	err = ch.PublishWithContext(
+		context.Background(),
+		"",
+		d.ReplyTo,
+		false,
+		false,
+		ampq.Publishing{
+			ContentType:   resp.ContentType,
+			CorrelationId: d.CorrelationId,
+			Body:          resp.Body,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to publish response: %v", err)
+	}
+
+	err = d.Ack(false)
+	if err != nil {
+		log.Printf("Failed to ack delivery: %v", err)
+	}
+}
+
+func (t *AMQPTransport) Call(exchange, key string, req Message, timeout time.Duration) (Message, error) {
+	t.mu.Lock()
+	conn := t.conn
+	t.mu.Unlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return Message{}, fmt.Errorf("Failed to create channel: %v", err)
+	}
+	defer ch.Close()
+
+	ds, err := ch.Consume(replyToQueue, "", true, false, false, false, nil)
+	if err != nil {
+		return Message{}, fmt.Errorf("Failed to consume replies: %v", err)
+	}
+
+	correlationID := strconv.FormatInt(time.Now().UnixNano(), 36)
+	err = ch.PublishWithContext(
+		context.Background(),
+		exchange,
+		key,
+		false,
+		false,
+		ampq.Publishing{
+			ContentType:   req.ContentType,
+			CorrelationId: correlationID,
+			ReplyTo:       replyToQueue,
+			Body:          req.Body,
+		},
+	)
+	if err != nil {
+		return Message{}, fmt.Errorf("Failed to publish: %v", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case d, ok := <-ds:
+			if !ok {
+				return Message{}, fmt.Errorf("Reply channel closed")
+			}
+			if d.CorrelationId != correlationID {
+				continue
+			}
+			return Message{ContentType: d.ContentType, Body: d.Body}, nil
+
+		case <-timer.C:
+			return Message{}, fmt.Errorf("Timed out after %v waiting for a reply", timeout)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package pubsub
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ampq "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeConn stands in for a connection to one node. Subscriptions in these
+// tests never open channels, so Channel hands out none.
+type fakeConn struct {
+	url    string
+	closes chan *ampq.Error
+	once   *sync.Once
+}
+
+func (c *fakeConn) Channel() (*ampq.Channel, error) {
+	return nil, nil
+}
+
+func (c *fakeConn) NotifyClose(receiver chan *ampq.Error) chan *ampq.Error {
+	c.closes = receiver
+	return receiver
+}
+
+func (c *fakeConn) Close() error {
+	c.once.Do(func() { close(c.closes) })
+	return nil
+}
+
+// drop loses the connection as if the node went down.
+func (c *fakeConn) drop() {
+	c.once.Do(func() {
+		c.closes <- &ampq.Error{Code: ampq.ConnectionForced, Reason: "node down"}
+		close(c.closes)
+	})
+}
+
+// fakeCluster is a set of nodes that can be taken down and brought back.
+type fakeCluster struct {
+	down  map[string]bool
+	dials []string
+	conns []*fakeConn
+	mu    *sync.Mutex
+}
+
+func newFakeCluster(down ...string) *fakeCluster {
+	c := &fakeCluster{down: map[string]bool{}, mu: &sync.Mutex{}}
+	for _, url := range down {
+		c.down[url] = true
+	}
+	return c
+}
+
+func (c *fakeCluster) dial(url string) (amqpConnection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dials = append(c.dials, url)
+	if c.down[url] {
+		return nil, errors.New("connection refused")
+	}
+	conn := &fakeConn{url: url, once: &sync.Once{}}
+	c.conns = append(c.conns, conn)
+	return conn, nil
+}
+
+func (c *fakeCluster) setDown(url string, down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down[url] = down
+}
+
+func (c *fakeCluster) dialed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.dials...)
+}
+
+func currentURL(t *AMQPTransport) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conn.(*fakeConn).url
+}
+
+// recordSubscribe adds a subscription that reports each node it is set up on.
+func recordSubscribe(t *testing.T, tr *AMQPTransport) <-chan string {
+	t.Helper()
+	urls := make(chan string, 8)
+	err := tr.subscribe(func(conn amqpConnection) error {
+		urls <- conn.(*fakeConn).url
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	return urls
+}
+
+func nextURL(t *testing.T, urls <-chan string) string {
+	t.Helper()
+	select {
+	case url := <-urls:
+		return url
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting to resubscribe")
+		return ""
+	}
+}
+
+func TestAMQPConnectsToFirstReachableNode(t *testing.T) {
+	cluster := newFakeCluster("amqp://a")
+	tr, err := newAMQPTransport(DialOptions{URLs: []string{"amqp://a", "amqp://b", "amqp://c"}}, cluster.dial)
+	if err != nil {
+		t.Fatalf("newAMQPTransport: %v", err)
+	}
+	defer tr.Close()
+
+	if url := currentURL(tr); url != "amqp://b" {
+		t.Errorf("connected to %s, want amqp://b", url)
+	}
+	dials := cluster.dialed()
+	if len(dials) != 2 || dials[0] != "amqp://a" || dials[1] != "amqp://b" {
+		t.Errorf("dialed %v, want amqp://a then amqp://b", dials)
+	}
+}
+
+func TestAMQPFailsWhenNoNodeIsReachable(t *testing.T) {
+	cluster := newFakeCluster("amqp://a", "amqp://b")
+	_, err := newAMQPTransport(DialOptions{URLs: []string{"amqp://a", "amqp://b"}}, cluster.dial)
+	if err == nil {
+		t.Fatal("newAMQPTransport succeeded with every node down")
+	}
+}
+
+func TestAMQPFailsOverAndResubscribes(t *testing.T) {
+	cluster := newFakeCluster()
+	tr, err := newAMQPTransport(DialOptions{URLs: []string{"amqp://a", "amqp://b"}}, cluster.dial)
+	if err != nil {
+		t.Fatalf("newAMQPTransport: %v", err)
+	}
+	defer tr.Close()
+
+	urls := recordSubscribe(t, tr)
+	if url := nextURL(t, urls); url != "amqp://a" {
+		t.Fatalf("subscribed on %s, want amqp://a", url)
+	}
+
+	// The node we lost is tried last, so we move on to the next one
+	cluster.setDown("amqp://a", true)
+	cluster.conns[0].drop()
+	if url := nextURL(t, urls); url != "amqp://b" {
+		t.Errorf("resubscribed on %s, want amqp://b", url)
+	}
+	if url := currentURL(tr); url != "amqp://b" {
+		t.Errorf("connected to %s, want amqp://b", url)
+	}
+}
+
+func TestAMQPRetriesUntilANodeComesBack(t *testing.T) {
+	cluster := newFakeCluster()
+	tr, err := newAMQPTransport(DialOptions{URLs: []string{"amqp://a"}}, cluster.dial)
+	if err != nil {
+		t.Fatalf("newAMQPTransport: %v", err)
+	}
+	defer tr.Close()
+
+	urls := recordSubscribe(t, tr)
+	nextURL(t, urls)
+
+	cluster.setDown("amqp://a", true)
+	cluster.conns[0].drop()
+	time.Sleep(reconnectMinBackoff / 2)
+	cluster.setDown("amqp://a", false)
+
+	if url := nextURL(t, urls); url != "amqp://a" {
+		t.Errorf("resubscribed on %s, want amqp://a", url)
+	}
+	if dials := cluster.dialed(); len(dials) < 3 {
+		t.Errorf("dialed %v, want a failed attempt before reconnecting", dials)
+	}
+}
+
+func TestAMQPCloseStopsReconnecting(t *testing.T) {
+	cluster := newFakeCluster()
+	tr, err := newAMQPTransport(DialOptions{URLs: []string{"amqp://a"}}, cluster.dial)
+	if err != nil {
+		t.Fatalf("newAMQPTransport: %v", err)
+	}
+
+	err = tr.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if dials := cluster.dialed(); len(dials) != 1 {
+		t.Errorf("dialed %v after closing, want no reconnects", dials)
+	}
+}
@@ -0,0 +1,53 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// inflight counts the handlers a transport is running, so draining can stop
+// new ones from starting and wait for the rest.
+type inflight struct {
+	draining bool
+	wg       *sync.WaitGroup
+	mu       *sync.Mutex
+}
+
+func newInflight() *inflight {
+	return &inflight{wg: &sync.WaitGroup{}, mu: &sync.Mutex{}}
+}
+
+// start reports whether a handler may run. If it may, done must be called
+// once it has finished.
+func (f *inflight) start() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draining {
+		return false
+	}
+	f.wg.Add(1)
+	return true
+}
+
+func (f *inflight) done() {
+	f.wg.Done()
+}
+
+func (f *inflight) drain(timeout time.Duration) error {
+	f.mu.Lock()
+	f.draining = true
+	f.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("Timed out after %v waiting for handlers to finish", timeout)
+	}
+}
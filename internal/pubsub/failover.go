@@ -0,0 +1,48 @@
+package pubsub
+
+import (
+	"math/rand"
+	"slices"
+	"time"
+)
+
+const (
+	FailoverRoundRobin = "round-robin"
+	FailoverRandom     = "random"
+
+	reconnectMinBackoff = 500 * time.Millisecond
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+// brokerPool decides which node to try next. Round robin goes through the
+// URLs in order, starting after the node last connected to, so a lost node
+// is the last one retried. Random shuffles them on every attempt, which
+// spreads many clients across the cluster.
+type brokerPool struct {
+	urls   []string
+	random bool
+	next   int
+}
+
+func newBrokerPool(opts DialOptions) *brokerPool {
+	return &brokerPool{urls: opts.URLs, random: opts.Failover == FailoverRandom}
+}
+
+// order is every URL, in the order to try them.
+func (p *brokerPool) order() []string {
+	if p.random {
+		urls := slices.Clone(p.urls)
+		rand.Shuffle(len(urls), func(i, j int) {
+			urls[i], urls[j] = urls[j], urls[i]
+		})
+		return urls
+	}
+	return append(slices.Clone(p.urls[p.next:]), p.urls[:p.next]...)
+}
+
+func (p *brokerPool) connected(url string) {
+	i := slices.Index(p.urls, url)
+	if i >= 0 {
+		p.next = (i + 1) % len(p.urls)
+	}
+}
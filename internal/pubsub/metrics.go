@@ -0,0 +1,63 @@
+package pubsub
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics are registered with Prometheus' default registry, so a binary
+// only has to serve promhttp.Handler to expose them.
+var (
+	messagesPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_pubsub_published_total",
+		Help: "Messages published, by exchange and routing key.",
+	}, []string{"exchange", "key"})
+
+	publishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_pubsub_publish_failures_total",
+		Help: "Messages that failed to publish, by exchange and routing key.",
+	}, []string{"exchange", "key"})
+
+	messagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_pubsub_consumed_total",
+		Help: "Messages handled, by exchange, routing key and how they were acknowledged.",
+	}, []string{"exchange", "key", "ack"})
+
+	decodeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_pubsub_decode_failures_total",
+		Help: "Messages discarded because they could not be decoded.",
+	}, []string{"exchange", "key"})
+
+	handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "peril_pubsub_handler_duration_seconds",
+		Help:    "How long handlers take to process a message.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"exchange", "key"})
+
+	reconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_pubsub_reconnects_total",
+		Help: "Connections re-established after losing the broker.",
+	}, []string{"transport"})
+)
+
+// keyLabel is the part of a routing key before the first dot. Most keys end
+// in a username, which would make a time series per player.
+func keyLabel(key string) string {
+	prefix, _, _ := strings.Cut(key, ".")
+	return prefix
+}
+
+func (a AckType) String() string {
+	switch a {
+	case Ack:
+		return "ack"
+	case NackRequeue:
+		return "nack_requeue"
+	case NackDiscard:
+		return "nack_discard"
+	default:
+		return "unknown"
+	}
+}
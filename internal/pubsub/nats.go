@@ -0,0 +1,360 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// natsStream holds every message published through NATS. Durable
+	// queues become durable consumers on it and streams become ordered
+	// consumers, so nothing needs declaring up front.
+	natsStream       = "PERIL"
+	natsStreamMaxAge = 24 * time.Hour
+	natsTimeout      = 5 * time.Second
+
+	// natsTransientTimeout is how long the server keeps a transient
+	// queue's consumer after its subscriber goes away.
+	natsTransientTimeout = 1 * time.Minute
+
+	// natsRPCPrefix keeps requests out of the stream, so the only reply a
+	// caller gets is the server's.
+	natsRPCPrefix = "rpc"
+
+	natsContentType = "Content-Type"
+)
+
+// NATSTransport runs Peril on NATS JetStream. Exchanges and routing keys
+// become subjects, so army_moves.* on peril_topic is peril_topic.army_moves.*.
+type NATSTransport struct {
+	nc       *nats.Conn
+	js       jetstream.JetStream
+	opts     DialOptions
+	consumes []jetstream.ConsumeContext
+	inflight *inflight
+	mu       *sync.Mutex
+}
+
+// DialNATS connects over TLS if any TLS options are set. External auth
+// only presents the client certificate, for servers that map certificates
+// to users.
+//
+// The NATS client fails over between opts.URLs itself, and its consumers
+// and subscriptions carry on after it reconnects.
+func DialNATS(opts DialOptions) (*NATSTransport, error) {
+	opts = opts.withDefaults()
+	for _, url := range opts.URLs {
+		err := opts.checkAuth(url)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+	natsOpts := []nats.Option{
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("Lost connection to nats: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			reconnects.WithLabelValues("nats").Inc()
+			log.Printf("Reconnected to nats")
+		}),
+	}
+	if opts.Failover != FailoverRandom {
+		natsOpts = append(natsOpts, nats.DontRandomize())
+	}
+	if tlsConfig != nil {
+		natsOpts = append(natsOpts, nats.Secure(tlsConfig))
+	}
+	if opts.Username != "" {
+		natsOpts = append(natsOpts, nats.UserInfo(opts.Username, opts.Password))
+	}
+
+	nc, err := nats.Connect(strings.Join(opts.URLs, ","), natsOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to nats: %v", err)
+	}
+	t, err := NewNATSTransport(nc, opts)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// NewNATSTransport uses an existing connection, creating the stream every
+// message is stored in if it doesn't exist yet. Only the prefetch and
+// workers are taken from opts. Closing the transport closes the connection.
+func NewNATSTransport(nc *nats.Conn, opts DialOptions) (*NATSTransport, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open jetstream: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name: natsStream,
+		Subjects: []string{
+			natsSubject("peril_direct", ">"),
+			natsSubject("peril_topic", ">"),
+		},
+		Retention: jetstream.LimitsPolicy,
+		MaxAge:    natsStreamMaxAge,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create stream: %v", err)
+	}
+
+	return &NATSTransport{
+		nc:       nc,
+		js:       js,
+		opts:     opts.withDefaults(),
+		inflight: newInflight(),
+		mu:       &sync.Mutex{},
+	}, nil
+}
+
+// natsSubject maps a routing key on an exchange to a subject. Topic
+// wildcards carry over, except that # is > in NATS.
+func natsSubject(exchange, key string) string {
+	if key == "#" || strings.HasSuffix(key, ".#") {
+		key = strings.TrimSuffix(key, "#") + ">"
+	}
+	return fmt.Sprintf("%s.%s", exchange, key)
+}
+
+func natsRoutingKey(subject string) string {
+	_, key, _ := strings.Cut(subject, ".")
+	return key
+}
+
+// natsConsumerName turns a queue name into a valid consumer name.
+func natsConsumerName(queueName string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(queueName)
+}
+
+// Drain leaves messages it doesn't handle unacknowledged, so JetStream
+// redelivers them once their ack wait runs out.
+func (t *NATSTransport) Drain(timeout time.Duration) error {
+	t.stopConsuming()
+	return t.inflight.drain(timeout)
+}
+
+func (t *NATSTransport) Close() error {
+	t.stopConsuming()
+	return t.nc.Drain()
+}
+
+func (t *NATSTransport) stopConsuming() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, cc := range t.consumes {
+		cc.Stop()
+	}
+	t.consumes = nil
+}
+
+func (t *NATSTransport) Publish(exchange, key string, msg Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	_, err := t.js.PublishMsg(ctx, &nats.Msg{
+		Subject: natsSubject(exchange, key),
+		Header:  nats.Header{natsContentType: []string{msg.ContentType}},
+		Data:    msg.Body,
+	})
+	return err
+}
+
+// Subscribe maps durable and quorum queues to durable consumers, which
+// every subscriber with the same queue name shares. Transient queues get a
+// consumer of their own. NATS has no dead letter exchange, so discarded
+// messages are simply dropped. JetStream has no single active consumer
+// either, so subscribers to such a queue share it like any other.
+func (t *NATSTransport) Subscribe(exchange, queueName, key string, cfg QueueConfig, handler func(Message) AckType) error {
+	err := cfg.Validate()
+	if err != nil {
+		return fmt.Errorf("Invalid queue config: %v", err)
+	}
+	if cfg.Type == Stream {
+		return errors.New("Stream queues must be read with SubscribeStream")
+	}
+
+	consumerCfg := jetstream.ConsumerConfig{
+		FilterSubject: natsSubject(exchange, key),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+		MaxAckPending: t.opts.Prefetch,
+	}
+	if cfg.durable() {
+		consumerCfg.Durable = natsConsumerName(queueName)
+	} else {
+		consumerCfg.InactiveThreshold = natsTransientTimeout
+	}
+	if cfg.DeliveryLimit > 0 {
+		// The first delivery isn't a redelivery
+		consumerCfg.MaxDeliver = cfg.DeliveryLimit + 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	consumer, err := t.js.CreateOrUpdateConsumer(ctx, natsStream, consumerCfg)
+	if err != nil {
+		return fmt.Errorf("Failed to create consumer: %v", err)
+	}
+
+	return t.consume(consumer, t.opts.Workers, func(m jetstream.Msg) {
+		var err error
+		switch handler(natsMessage(m)) {
+		case Ack:
+			err = m.Ack()
+		case NackRequeue:
+			err = m.Nak()
+		case NackDiscard:
+			err = m.Term()
+		}
+		if err != nil {
+			log.Printf("Failed to ack delivery: %v", err)
+		}
+	})
+}
+
+// SubscribeStream reads the subjects matching key with an ordered
+// consumer. Every stream lives in the same JetStream stream, so streamName
+// is not needed.
+func (t *NATSTransport) SubscribeStream(exchange, streamName, key string, offset StreamOffset, handler func(Message) AckType) error {
+	cfg := jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{natsSubject(exchange, key)},
+	}
+	switch v := offset.value.(type) {
+	case time.Time:
+		cfg.DeliverPolicy = jetstream.DeliverByStartTimePolicy
+		cfg.OptStartTime = &v
+	case int64:
+		// RabbitMQ offsets start at zero, JetStream sequences at one
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = uint64(v) + 1
+	case string:
+		switch v {
+		case "first":
+			cfg.DeliverPolicy = jetstream.DeliverAllPolicy
+		case "last":
+			cfg.DeliverPolicy = jetstream.DeliverLastPolicy
+		default:
+			cfg.DeliverPolicy = jetstream.DeliverNewPolicy
+		}
+	default:
+		cfg.DeliverPolicy = jetstream.DeliverNewPolicy
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	consumer, err := t.js.OrderedConsumer(ctx, natsStream, cfg)
+	if err != nil {
+		return fmt.Errorf("Failed to create consumer: %v", err)
+	}
+
+	// Ordered consumers don't take acks, like a stream they only move on
+	return t.consume(consumer, 1, func(m jetstream.Msg) {
+		handler(natsMessage(m))
+	})
+}
+
+// DeclareStream has nothing to do, since the JetStream stream every
+// stream lives in already stores every message.
+func (t *NATSTransport) DeclareStream(exchange, streamName, key string) error {
+	return nil
+}
+
+// consume pulls from consumer with one subscription per worker, each of
+// which calls handler for its messages in turn.
+func (t *NATSTransport) consume(consumer jetstream.Consumer, workers int, handler jetstream.MessageHandler) error {
+	handle := func(m jetstream.Msg) {
+		if !t.inflight.start() {
+			return
+		}
+		defer t.inflight.done()
+		handler(m)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for range workers {
+		cc, err := consumer.Consume(handle, jetstream.PullMaxMessages(t.opts.Prefetch))
+		if err != nil {
+			return fmt.Errorf("Failed to consume: %v", err)
+		}
+		t.consumes = append(t.consumes, cc)
+	}
+	return nil
+}
+
+func natsMessage(m jetstream.Msg) Message {
+	return Message{
+		ContentType: m.Headers().Get(natsContentType),
+		Body:        m.Data(),
+		RoutingKey:  natsRoutingKey(m.Subject()),
+	}
+}
+
+// Serve uses core NATS request-reply. Servers sharing a queue name share
+// the requests.
+func (t *NATSTransport) Serve(exchange, queueName, key string, handler func(Message) (Message, error)) error {
+	subject := fmt.Sprintf("%s.%s", natsRPCPrefix, natsSubject(exchange, key))
+	_, err := t.nc.QueueSubscribe(subject, natsConsumerName(queueName), func(m *nats.Msg) {
+		if !t.inflight.start() {
+			return
+		}
+		defer t.inflight.done()
+
+		resp, err := handler(Message{
+			ContentType: m.Header.Get(natsContentType),
+			Body:        m.Data,
+			RoutingKey:  key,
+		})
+		if err != nil {
+			log.Printf("Failed to handle request: %v", err)
+			return
+		}
+
+		err = m.RespondMsg(&nats.Msg{
+			Header: nats.Header{natsContentType: []string{resp.ContentType}},
+			Data:   resp.Body,
+		})
+		if err != nil {
+			log.Printf("Failed to publish response: %v", err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to subscribe: %v", err)
+	}
+	return nil
+}
+
+func (t *NATSTransport) Call(exchange, key string, req Message, timeout time.Duration) (Message, error) {
+	resp, err := t.nc.RequestMsg(&nats.Msg{
+		Subject: fmt.Sprintf("%s.%s", natsRPCPrefix, natsSubject(exchange, key)),
+		Header:  nats.Header{natsContentType: []string{req.ContentType}},
+		Data:    req.Body,
+	}, timeout)
+	if errors.Is(err, nats.ErrTimeout) {
+		return Message{}, fmt.Errorf("Timed out after %v waiting for a reply", timeout)
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("Failed to call: %v", err)
+	}
+	return Message{ContentType: resp.Header.Get(natsContentType), Body: resp.Data}, nil
+}
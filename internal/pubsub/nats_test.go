@@ -0,0 +1,264 @@
+package pubsub
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// newNATSTestTransport runs an embedded JetStream server for one test.
+func newNATSTestTransport(t *testing.T) *NATSTransport {
+	t.Helper()
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	tr, err := NewNATSTransport(nc, DialOptions{})
+	if err != nil {
+		nc.Close()
+		t.Fatalf("NewNATSTransport: %v", err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+type natsTestMsg struct {
+	Text string
+}
+
+// receive waits for the next message a handler passes on.
+func receive[T any](t *testing.T, c <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-c:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		var zero T
+		return zero
+	}
+}
+
+// expectNone fails if a handler passes on anything else for a while.
+func expectNone[T any](t *testing.T, c <-chan T) {
+	t.Helper()
+	select {
+	case v := <-c:
+		t.Fatalf("unexpected message: %v", v)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestNATSPublishSubscribe(t *testing.T) {
+	tr := newNATSTestTransport(t)
+
+	type delivery struct {
+		msg natsTestMsg
+		key string
+	}
+	got := make(chan delivery, 1)
+	err := SubscribeJSONWithRoutingKey(tr, "peril_topic", "moves", "army_moves.*", Durable, func(m natsTestMsg, key string) AckType {
+		got <- delivery{m, key}
+		return Ack
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	err = PublishJSON(tr, "peril_topic", "army_moves.alice", natsTestMsg{Text: "hello"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	err = PublishJSON(tr, "peril_topic", "war.alice", natsTestMsg{Text: "not bound"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	d := receive(t, got)
+	if d.msg.Text != "hello" || d.key != "army_moves.alice" {
+		t.Errorf("got %q on %s, want hello on army_moves.alice", d.msg.Text, d.key)
+	}
+	expectNone(t, got)
+}
+
+func TestNATSDurableQueueIsShared(t *testing.T) {
+	tr := newNATSTestTransport(t)
+
+	got := make(chan string, 4)
+	for _, name := range []string{"first", "second"} {
+		err := SubscribeJSON(tr, "peril_topic", "shared", "k", Durable, func(m natsTestMsg) AckType {
+			got <- name
+			return Ack
+		})
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+	}
+
+	err := PublishJSON(tr, "peril_topic", "k", natsTestMsg{Text: "once"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	receive(t, got)
+	expectNone(t, got)
+}
+
+func TestNATSAcks(t *testing.T) {
+	tests := []struct {
+		ack        AckType
+		deliveries int
+	}{
+		{Ack, 1},
+		{NackDiscard, 1},
+		// Nak redelivers until the handler acks
+		{NackRequeue, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ack.String(), func(t *testing.T) {
+			tr := newNATSTestTransport(t)
+
+			got := make(chan int, 8)
+			mu := &sync.Mutex{}
+			deliveries := 0
+			err := SubscribeJSON(tr, "peril_topic", "q", "k", Durable, func(natsTestMsg) AckType {
+				mu.Lock()
+				defer mu.Unlock()
+				deliveries++
+				got <- deliveries
+				if deliveries == 3 {
+					return Ack
+				}
+				return tt.ack
+			})
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+
+			err = PublishJSON(tr, "peril_topic", "k", natsTestMsg{Text: "hi"})
+			if err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+			for range tt.deliveries {
+				receive(t, got)
+			}
+			expectNone(t, got)
+		})
+	}
+}
+
+func TestNATSDeliveryLimit(t *testing.T) {
+	tr := newNATSTestTransport(t)
+
+	got := make(chan struct{}, 8)
+	cfg := NewQueueConfig(Quorum)
+	cfg.DeliveryLimit = 1
+	err := tr.Subscribe("peril_topic", "q", "k", cfg, func(Message) AckType {
+		got <- struct{}{}
+		return NackRequeue
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	err = PublishJSON(tr, "peril_topic", "k", natsTestMsg{Text: "hi"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	// The first delivery and one redelivery
+	receive(t, got)
+	receive(t, got)
+	expectNone(t, got)
+}
+
+func TestNATSDiscardsUndecodable(t *testing.T) {
+	tr := newNATSTestTransport(t)
+
+	got := make(chan natsTestMsg, 2)
+	err := SubscribeJSON(tr, "peril_topic", "q", "k", Durable, func(m natsTestMsg) AckType {
+		got <- m
+		return Ack
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	err = tr.Publish("peril_topic", "k", Message{ContentType: "application/json", Body: []byte("{")})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	err = PublishJSON(tr, "peril_topic", "k", natsTestMsg{Text: "after"})
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	if m := receive(t, got); m.Text != "after" {
+		t.Errorf("got %q, want the message after the undecodable one", m.Text)
+	}
+	expectNone(t, got)
+}
+
+func TestNATSStreamFromFirst(t *testing.T) {
+	tr := newNATSTestTransport(t)
+
+	for _, text := range []string{"one", "two"} {
+		err := PublishGob(tr, "peril_topic", "game_logs.alice", natsTestMsg{Text: text})
+		if err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	got := make(chan natsTestMsg, 4)
+	err := SubscribeStreamGob(tr, "peril_topic", "game_logs_stream", "game_logs.*", OffsetFirst(), func(m natsTestMsg) AckType {
+		got <- m
+		return Ack
+	})
+	if err != nil {
+		t.Fatalf("SubscribeStream: %v", err)
+	}
+
+	for _, want := range []string{"one", "two"} {
+		if m := receive(t, got); m.Text != want {
+			t.Errorf("got %q, want %q", m.Text, want)
+		}
+	}
+	expectNone(t, got)
+}
+
+func TestNATSCall(t *testing.T) {
+	tr := newNATSTestTransport(t)
+
+	err := tr.Serve("peril_direct", "rpc", "echo", func(req Message) (Message, error) {
+		return Message{ContentType: req.ContentType, Body: append([]byte("re: "), req.Body...)}, nil
+	})
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	resp, err := tr.Call("peril_direct", "echo", Message{ContentType: "text/plain", Body: []byte("hi")}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if string(resp.Body) != "re: hi" || resp.ContentType != "text/plain" {
+		t.Errorf("got %q (%s), want re: hi (text/plain)", resp.Body, resp.ContentType)
+	}
+}
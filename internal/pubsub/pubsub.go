@@ -2,12 +2,12 @@ package pubsub
 
 import (
 	"bytes"
-	"context"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
 	"log"
 
+	"github.com/prometheus/client_golang/prometheus"
 	ampq "github.com/rabbitmq/amqp091-go"
 )
 
@@ -15,6 +15,8 @@ type SimpleQueueType int
 const (
 	Durable SimpleQueueType = iota
 	Transient
+	Quorum
+	Stream
 )
 
 type AckType int
@@ -24,7 +26,7 @@ const (
 	NackDiscard
 )
 
-func PublishGob[T any] (ch *ampq.Channel, exchange, key string, val T) error {
+func PublishGob[T any] (t Transport, exchange, key string, val T) error {
 	var buf bytes.Buffer
 	encoder := gob.NewEncoder(&buf)
 	err := encoder.Encode(val)
@@ -32,45 +34,31 @@ func PublishGob[T any] (ch *ampq.Channel, exchange, key string, val T) error {
 		return fmt.Errorf("Failed to marshal object: %v", err)
 	}
 
-	err = ch.PublishWithContext(
-		context.Background(),
-		exchange,
-		key,
-		false,
-		false,
-		ampq.Publishing{
-			ContentType: "application/gob",
-			Body: buf.Bytes(),
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("Failed to publish: %v", err)
-	}
-
-	return nil
+	return publish(t, exchange, key, Message{
+		ContentType: "application/gob",
+		Body: buf.Bytes(),
+	})
 }
 
-func PublishJSON[T any] (ch *ampq.Channel, exchange, key string, val T) error {
+func PublishJSON[T any] (t Transport, exchange, key string, val T) error {
 	json, err := json.Marshal(val)
 	if err != nil {
 		return fmt.Errorf("Failed to marshal object: %v", err)
 	}
 
-	err = ch.PublishWithContext(
-		context.Background(),
-		exchange,
-		key,
-		false,
-		false,
-		ampq.Publishing{
-			ContentType: "application/json",
-			Body: json,
-		},
-	)
+	return publish(t, exchange, key, Message{
+		ContentType: "application/json",
+		Body: json,
+	})
+}
+
+func publish(t Transport, exchange, key string, msg Message) error {
+	err := t.Publish(exchange, key, msg)
 	if err != nil {
+		publishFailures.WithLabelValues(exchange, keyLabel(key)).Inc()
 		return fmt.Errorf("Failed to publish: %v", err)
 	}
-
+	messagesPublished.WithLabelValues(exchange, keyLabel(key)).Inc()
 	return nil
 }
 
@@ -81,139 +69,162 @@ func DeclareAndBind(
 	key string,
 	queueType SimpleQueueType,
 ) (*ampq.Channel, ampq.Queue, error){
-	ch, err := conn.Channel()
-	if err != nil {
-		return nil, ampq.Queue{}, fmt.Errorf("Failed to create channel: %v", err)
-	}
-
-	q, err := ch.QueueDeclare(
-		queueName,
-		queueType == Durable,
-		queueType != Durable,
-		queueType != Durable,
-		false,
-		ampq.Table{"x-dead-letter-exchange": "peril_dlx"},
-	)
-	if err != nil {
-		return nil, ampq.Queue{}, fmt.Errorf("Failed to declare queue: %v", err)
-	}
-
-	err = ch.QueueBind(q.Name, key, exchange, false, nil)
-	if err != nil {
-		return nil, ampq.Queue{}, fmt.Errorf("Failed to bind queue: %v", err)
-	}
-
-	return ch, q, nil
+	return DeclareAndBindConfig(conn, exchange, queueName, key, NewQueueConfig(queueType))
 }
 
 func SubscribeGob[T any] (
-	conn *ampq.Connection,
+	t Transport,
 	exchange string,
 	queueName string,
 	key string,
 	queueType SimpleQueueType,
 	handler func(T) AckType,
 ) error {
-	return subscribe(
-		conn,
+	return t.Subscribe(
 		exchange,
 		queueName,
 		key,
-		queueType,
-		handler,
-		func(b []byte) (T, error) {
-			buf := bytes.NewBuffer(b)
-			decoder := gob.NewDecoder(buf)
-			var t T
-			err := decoder.Decode(&t)
-
-			return t, err
-		},
+		NewQueueConfig(queueType),
+		decode(exchange, key, ignoreRoutingKey(handler), unmarshalGob[T]),
 	)
 }
 
 func SubscribeJSON[T any] (
-	conn *ampq.Connection,
+	t Transport,
 	exchange string,
 	queueName string,
 	key string,
 	queueType SimpleQueueType,
 	handler func(T) AckType,
 ) error {
-	return subscribe(
-		conn,
+	return t.Subscribe(
 		exchange,
 		queueName,
 		key,
-		queueType,
-		handler,
-		func(b []byte) (T, error) {
-			var t T
-			err := json.Unmarshal(b, &t)
-			return t, err
-		},
+		NewQueueConfig(queueType),
+		decode(exchange, key, ignoreRoutingKey(handler), unmarshalJSON[T]),
 	)
 }
 
-func subscribe[T any](
-	conn *ampq.Connection,
+// SubscribeGobWithRoutingKey is SubscribeGob for handlers that need to know
+// which routing key each message was published with. It takes a whole
+// QueueConfig, for queues that need more than their type's defaults.
+func SubscribeGobWithRoutingKey[T any] (
+	t Transport,
+	exchange string,
+	queueName string,
+	key string,
+	cfg QueueConfig,
+	handler func(T, string) AckType,
+) error {
+	return t.Subscribe(
+		exchange,
+		queueName,
+		key,
+		cfg,
+		decode(exchange, key, handler, unmarshalGob[T]),
+	)
+}
+
+// SubscribeJSONWithRoutingKey is SubscribeJSON for handlers that need to
+// know which routing key each message was published with.
+func SubscribeJSONWithRoutingKey[T any] (
+	t Transport,
 	exchange string,
 	queueName string,
 	key string,
 	queueType SimpleQueueType,
+	handler func(T, string) AckType,
+) error {
+	return t.Subscribe(
+		exchange,
+		queueName,
+		key,
+		NewQueueConfig(queueType),
+		decode(exchange, key, handler, unmarshalJSON[T]),
+	)
+}
+
+// SubscribeStreamGob reads a stream starting at offset. Every subscriber
+// sees every message, so independent readers can each replay the stream.
+func SubscribeStreamGob[T any] (
+	t Transport,
+	exchange string,
+	streamName string,
+	key string,
+	offset StreamOffset,
 	handler func(T) AckType,
-	unmarshaller func([]byte) (T, error),
 ) error {
-	ch, _, err := DeclareAndBind(conn, exchange, queueName, key, queueType)
-	if err != nil {
-		return fmt.Errorf("Failed to declare and bind: %v", err)
-	}
+	return t.SubscribeStream(
+		exchange,
+		streamName,
+		key,
+		offset,
+		decode(exchange, key, ignoreRoutingKey(handler), unmarshalGob[T]),
+	)
+}
 
-	err = ch.Qos(10, 0, false)
-	if err != nil {
-		return fmt.Errorf("Failed to set prefetch size: %v\n", err)
-	}
+func SubscribeStreamJSON[T any] (
+	t Transport,
+	exchange string,
+	streamName string,
+	key string,
+	offset StreamOffset,
+	handler func(T) AckType,
+) error {
+	return t.SubscribeStream(
+		exchange,
+		streamName,
+		key,
+		offset,
+		decode(exchange, key, ignoreRoutingKey(handler), unmarshalJSON[T]),
+	)
+}
 
-	ds, err := ch.Consume(queueName, "", false, false, false, false, nil)
-	if err != nil {
-		return fmt.Errorf("Failed to consume queue: %v", err)
+func ignoreRoutingKey[T any](handler func(T) AckType) func(T, string) AckType {
+	return func(t T, _ string) AckType {
+		return handler(t)
 	}
+}
 
-	go func() {
-		for d := range ds {
-			t, err := unmarshaller(d.Body)
-			if err != nil {
-				log.Printf("Failed to decode json: %v", err)
-				continue
-			}
-
-			ack := handler(t)
-
-			switch ack {
-			case Ack:
-				err = d.Ack(false)
-				if err != nil {
-					log.Printf("Failed to ack delivery: %v", err)
-					continue
-				}
-
-			case NackRequeue:
-				err = d.Nack(false, true)
-				if err != nil {
-					log.Printf("Failed to nack delivery: %v", err)
-					continue
-				}
-
-			case NackDiscard:
-				err = d.Nack(false, false)
-				if err != nil {
-					log.Printf("Failed to nack delivery: %v", err)
-					continue
-				}
-
-			}
+// decode adapts a typed handler to the raw messages a Transport delivers,
+// recording metrics for the exchange and key it subscribed with. Messages
+// that fail to decode are discarded.
+func decode[T any](
+	exchange string,
+	key string,
+	handler func(T, string) AckType,
+	unmarshaller func([]byte) (T, error),
+) func(Message) AckType {
+	key = keyLabel(key)
+	return func(msg Message) AckType {
+		t, err := unmarshaller(msg.Body)
+		if err != nil {
+			log.Printf("Failed to decode message: %v", err)
+			decodeFailures.WithLabelValues(exchange, key).Inc()
+			messagesConsumed.WithLabelValues(exchange, key, NackDiscard.String()).Inc()
+			return NackDiscard
 		}
-	} ()
 
-	return nil
+		timer := prometheus.NewTimer(handlerDuration.WithLabelValues(exchange, key))
+		ack := handler(t, msg.RoutingKey)
+		timer.ObserveDuration()
+		messagesConsumed.WithLabelValues(exchange, key, ack.String()).Inc()
+		return ack
+	}
+}
+
+func unmarshalGob[T any](b []byte) (T, error) {
+	buf := bytes.NewBuffer(b)
+	decoder := gob.NewDecoder(buf)
+	var t T
+	err := decoder.Decode(&t)
+
+	return t, err
+}
+
+func unmarshalJSON[T any](b []byte) (T, error) {
+	var t T
+	err := json.Unmarshal(b, &t)
+	return t, err
 }
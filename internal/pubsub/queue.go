@@ -0,0 +1,170 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+
+	ampq "github.com/rabbitmq/amqp091-go"
+)
+
+// defaultDeliveryLimit is how many times a quorum queue redelivers a
+// message before dead-lettering it.
+const defaultDeliveryLimit = 5
+
+// QueueConfig describes how a queue is declared. NewQueueConfig gives the
+// defaults for each SimpleQueueType.
+type QueueConfig struct {
+	Type       SimpleQueueType
+	AutoDelete bool
+	Exclusive  bool
+
+	// DeliveryLimit caps redeliveries of a message on a quorum queue, after
+	// which it goes to the dead letter exchange. Zero leaves it unlimited.
+	DeliveryLimit int
+
+	// SingleActiveConsumer delivers to one subscriber at a time, failing
+	// over to the next when it goes away, for work only one process may do.
+	SingleActiveConsumer bool
+}
+
+func NewQueueConfig(queueType SimpleQueueType) QueueConfig {
+	switch queueType {
+	case Transient:
+		return QueueConfig{Type: queueType, AutoDelete: true, Exclusive: true}
+	case Quorum:
+		return QueueConfig{Type: queueType, DeliveryLimit: defaultDeliveryLimit}
+	default:
+		return QueueConfig{Type: queueType}
+	}
+}
+
+func ParseQueueType(s string) (SimpleQueueType, error) {
+	switch s {
+	case "durable":
+		return Durable, nil
+	case "transient":
+		return Transient, nil
+	case "quorum":
+		return Quorum, nil
+	case "stream":
+		return Stream, nil
+	default:
+		return 0, fmt.Errorf("Unknown queue type: %q", s)
+	}
+}
+
+func (t SimpleQueueType) String() string {
+	switch t {
+	case Durable:
+		return "durable"
+	case Transient:
+		return "transient"
+	case Quorum:
+		return "quorum"
+	case Stream:
+		return "stream"
+	default:
+		return fmt.Sprintf("SimpleQueueType(%d)", int(t))
+	}
+}
+
+// Validate rejects combinations RabbitMQ would refuse to declare.
+func (c QueueConfig) Validate() error {
+	switch c.Type {
+	case Durable, Transient:
+		if c.DeliveryLimit != 0 {
+			return fmt.Errorf("%v queues do not support a delivery limit", c.Type)
+		}
+	case Quorum, Stream:
+		if c.AutoDelete || c.Exclusive {
+			return fmt.Errorf("%v queues can not be exclusive or auto-delete", c.Type)
+		}
+		if c.Type == Stream && c.DeliveryLimit != 0 {
+			return errors.New("stream queues do not support a delivery limit")
+		}
+		if c.Type == Stream && c.SingleActiveConsumer {
+			return errors.New("stream queues do not support a single active consumer")
+		}
+	default:
+		return fmt.Errorf("Unknown queue type: %v", c.Type)
+	}
+	if c.DeliveryLimit < 0 {
+		return fmt.Errorf("Invalid delivery limit: %d", c.DeliveryLimit)
+	}
+	return nil
+}
+
+func (c QueueConfig) durable() bool {
+	return c.Type != Transient
+}
+
+func (c QueueConfig) args() ampq.Table {
+	var args ampq.Table
+	switch c.Type {
+	case Stream:
+		// Streams keep messages after they are consumed, so they can't be
+		// dead-lettered
+		return ampq.Table{"x-queue-type": "stream"}
+	case Quorum:
+		args = ampq.Table{
+			"x-queue-type":           "quorum",
+			"x-dead-letter-exchange": "peril_dlx",
+		}
+		if c.DeliveryLimit > 0 {
+			args["x-delivery-limit"] = c.DeliveryLimit
+		}
+	default:
+		args = ampq.Table{"x-dead-letter-exchange": "peril_dlx"}
+	}
+	if c.SingleActiveConsumer {
+		args["x-single-active-consumer"] = true
+	}
+	return args
+}
+
+func DeclareAndBindConfig(
+	conn *ampq.Connection,
+	exchange string,
+	queueName string,
+	key string,
+	cfg QueueConfig,
+) (*ampq.Channel, ampq.Queue, error) {
+	return declareAndBind(conn, exchange, queueName, key, cfg)
+}
+
+func declareAndBind(
+	conn amqpConnection,
+	exchange string,
+	queueName string,
+	key string,
+	cfg QueueConfig,
+) (*ampq.Channel, ampq.Queue, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, ampq.Queue{}, fmt.Errorf("Invalid queue config: %v", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, ampq.Queue{}, fmt.Errorf("Failed to create channel: %v", err)
+	}
+
+	q, err := ch.QueueDeclare(
+		queueName,
+		cfg.durable(),
+		cfg.AutoDelete,
+		cfg.Exclusive,
+		false,
+		cfg.args(),
+	)
+	if err != nil {
+		return nil, ampq.Queue{}, fmt.Errorf("Failed to declare queue: %v", err)
+	}
+
+	err = ch.QueueBind(q.Name, key, exchange, false, nil)
+	if err != nil {
+		return nil, ampq.Queue{}, fmt.Errorf("Failed to bind queue: %v", err)
+	}
+
+	return ch, q, nil
+}
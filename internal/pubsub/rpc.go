@@ -0,0 +1,55 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+func ServeJSON[Req any, Resp any](
+	t Transport,
+	exchange string,
+	queueName string,
+	key string,
+	handler func(Req) Resp,
+) error {
+	return t.Serve(exchange, queueName, key, func(msg Message) (Message, error) {
+		var req Req
+		err := json.Unmarshal(msg.Body, &req)
+		if err != nil {
+			return Message{}, fmt.Errorf("Failed to decode json: %v", err)
+		}
+
+		body, err := json.Marshal(handler(req))
+		if err != nil {
+			return Message{}, fmt.Errorf("Failed to marshal response: %v", err)
+		}
+		return Message{ContentType: "application/json", Body: body}, nil
+	})
+}
+
+func CallJSON[Req any, Resp any](
+	t Transport,
+	exchange string,
+	key string,
+	req Req,
+	timeout time.Duration,
+) (Resp, error) {
+	var resp Resp
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return resp, fmt.Errorf("Failed to marshal object: %v", err)
+	}
+
+	msg, err := t.Call(exchange, key, Message{ContentType: "application/json", Body: body}, timeout)
+	if err != nil {
+		return resp, err
+	}
+
+	err = json.Unmarshal(msg.Body, &resp)
+	if err != nil {
+		return resp, fmt.Errorf("Failed to decode json: %v", err)
+	}
+	return resp, nil
+}
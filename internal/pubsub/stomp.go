@@ -0,0 +1,510 @@
+package pubsub
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/stomp"
+)
+
+const (
+	defaultSTOMPPort  = "61613"
+	defaultSTOMPSPort = "61614"
+
+	// stompReplyQueue is the temporary queue Call receives replies on.
+	// Calls take turns, so one per connection is enough.
+	stompReplyQueue = "peril_replies"
+)
+
+// STOMPTransport runs Peril on RabbitMQ's STOMP plugin, for clients that
+// can't speak AMQP. Queues are declared by the plugin from the headers of
+// the first subscription, so they are the same queues an AMQP subscriber
+// with the same names would use. Like AMQPTransport, it reconnects to the
+// next node when its connection drops and subscribes to everything again.
+type STOMPTransport struct {
+	opts DialOptions
+	pool *brokerPool
+	dial func(url string) (*stomp.Conn, error)
+
+	conn    *stomp.Conn
+	replies *stomp.Subscription
+	callMu  *sync.Mutex
+
+	// subs set up each subscription on a connection, and are run again
+	// on every new one
+	subs     []func(conn *stomp.Conn) error
+	inflight *inflight
+	closed   bool
+	mu       *sync.Mutex
+}
+
+// DialSTOMP connects over TLS for stomps:// URLs. The virtual host is the
+// URL's path, and the login its user info, unless opts override them.
+func DialSTOMP(opts DialOptions) (*STOMPTransport, error) {
+	opts = opts.withDefaults()
+	for _, brokerURL := range opts.URLs {
+		err := opts.checkAuth(brokerURL)
+		if err != nil {
+			return nil, err
+		}
+		u, _ := url.Parse(brokerURL)
+		if u.Scheme != "stomp" && u.Scheme != "stomps" {
+			return nil, fmt.Errorf("STOMP needs a stomp:// or stomps:// URL, not %s://", u.Scheme)
+		}
+	}
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return newSTOMPTransport(opts, func(brokerURL string) (*stomp.Conn, error) {
+		u, err := url.Parse(brokerURL)
+		if err != nil {
+			return nil, err
+		}
+
+		var nc net.Conn
+		if u.Scheme == "stomps" {
+			cfg := tlsConfig.Clone()
+			if cfg.ServerName == "" {
+				cfg.ServerName = u.Hostname()
+			}
+			nc, err = tls.Dial("tcp", stompAddr(u, defaultSTOMPSPort), cfg)
+		} else {
+			nc, err = net.Dial("tcp", stompAddr(u, defaultSTOMPPort))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := stomp.NewConn(nc, opts.stompOptions(u))
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+		return conn, nil
+	})
+}
+
+func stompAddr(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// stompOptions logs in as the URL's user unless opts name another, and
+// not at all with external auth, where the plugin takes the user from the
+// client certificate.
+func (o DialOptions) stompOptions(u *url.URL) stomp.Options {
+	opts := stomp.Options{Host: strings.TrimPrefix(u.Path, "/")}
+	if o.VHost != "" {
+		opts.Host = o.VHost
+	}
+	if o.Auth == AuthExternal {
+		return opts
+	}
+
+	if u.User != nil {
+		opts.Login = u.User.Username()
+		opts.Passcode, _ = u.User.Password()
+	}
+	if o.Username != "" {
+		opts.Login = o.Username
+		opts.Passcode = o.Password
+	}
+	return opts
+}
+
+// newSTOMPTransport connects to the first node in opts.URLs that dial can
+// reach.
+func newSTOMPTransport(opts DialOptions, dial func(url string) (*stomp.Conn, error)) (*STOMPTransport, error) {
+	t := &STOMPTransport{
+		opts:     opts,
+		pool:     newBrokerPool(opts),
+		dial:     dial,
+		callMu:   &sync.Mutex{},
+		inflight: newInflight(),
+		mu:       &sync.Mutex{},
+	}
+	err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// connect tries each node in turn, then resubscribes on the first one that
+// accepts the connection.
+func (t *STOMPTransport) connect() error {
+	var errs []error
+	for _, url := range t.pool.order() {
+		conn, err := t.dial(url)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		t.pool.connected(url)
+		t.conn = conn
+		t.replies = nil
+		for _, sub := range t.subs {
+			err := sub(conn)
+			if err != nil {
+				log.Printf("Failed to resubscribe: %v", err)
+			}
+		}
+		t.mu.Unlock()
+
+		go t.reconnect(conn)
+		return nil
+	}
+	return fmt.Errorf("Failed to connect to rabbitmq over stomp: %v", errors.Join(errs...))
+}
+
+// reconnect waits for the connection to drop, then connects again, backing
+// off while no node is reachable.
+func (t *STOMPTransport) reconnect(conn *stomp.Conn) {
+	<-conn.Done()
+	if t.isClosed() {
+		return
+	}
+	log.Printf("Lost connection to rabbitmq over stomp: %v", conn.Err())
+
+	backoff := reconnectMinBackoff
+	for {
+		err := t.connect()
+		if t.isClosed() {
+			return
+		}
+		if err == nil {
+			reconnects.WithLabelValues("stomp").Inc()
+			log.Printf("Reconnected to rabbitmq over stomp")
+			return
+		}
+		log.Printf("Failed to reconnect, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+func (t *STOMPTransport) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+// subscribe runs sub on the current connection, and keeps it to run again
+// after reconnecting.
+func (t *STOMPTransport) subscribe(sub func(conn *stomp.Conn) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := sub(t.conn)
+	if err != nil {
+		return err
+	}
+	t.subs = append(t.subs, sub)
+	return nil
+}
+
+func (t *STOMPTransport) Drain(timeout time.Duration) error {
+	return t.inflight.drain(timeout)
+}
+
+func (t *STOMPTransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	conn := t.conn
+	t.mu.Unlock()
+
+	select {
+	case <-conn.Done():
+		// Lost while reconnecting
+		return nil
+	default:
+	}
+	return conn.Close()
+}
+
+// StompDestination is RabbitMQ's STOMP name for publishing to, or binding a
+// queue on, an exchange with a routing key.
+func StompDestination(exchange, key string) string {
+	return fmt.Sprintf("/exchange/%s/%s", exchange, key)
+}
+
+func (t *STOMPTransport) Publish(exchange, key string, msg Message) error {
+	t.mu.Lock()
+	conn := t.conn
+	t.mu.Unlock()
+
+	return conn.Send(StompDestination(exchange, key), msg.ContentType, msg.Body, nil)
+}
+
+// stompHeaders describes a queue to RabbitMQ's STOMP plugin, which declares
+// it on first subscription. Without a name the plugin makes one up.
+func (c QueueConfig) stompHeaders(queueName string, prefetch int) map[string]string {
+	headers := map[string]string{
+		"durable":        strconv.FormatBool(c.durable()),
+		"auto-delete":    strconv.FormatBool(c.AutoDelete),
+		"exclusive":      strconv.FormatBool(c.Exclusive),
+		"prefetch-count": strconv.Itoa(prefetch),
+	}
+	if queueName != "" {
+		headers["x-queue-name"] = queueName
+	}
+	for k, v := range c.args() {
+		headers[k] = fmt.Sprint(v)
+	}
+	return headers
+}
+
+// stompOffset is the plugin's x-stream-offset header for o.
+func stompOffset(o StreamOffset) string {
+	switch v := o.value.(type) {
+	case time.Time:
+		return "timestamp=" + strconv.FormatInt(v.Unix(), 10)
+	case int64:
+		return "offset=" + strconv.FormatInt(v, 10)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (t *STOMPTransport) Subscribe(exchange, queueName, key string, cfg QueueConfig, handler func(Message) AckType) error {
+	err := cfg.Validate()
+	if err != nil {
+		return fmt.Errorf("Invalid queue config: %v", err)
+	}
+	if cfg.Type == Stream {
+		return errors.New("Stream queues must be read with SubscribeStream")
+	}
+
+	return t.subscribe(func(conn *stomp.Conn) error {
+		headers := cfg.stompHeaders(queueName, t.opts.Prefetch)
+		return t.consume(conn, exchange, key, headers, t.opts.Workers, func(f stomp.Frame) AckType {
+			return handler(stompMessage(exchange, f))
+		})
+	})
+}
+
+// SubscribeStream picks up after the last message handled when it
+// resubscribes, rather than starting from offset again.
+func (t *STOMPTransport) SubscribeStream(exchange, streamName, key string, offset StreamOffset, handler func(Message) AckType) error {
+	next := offset
+	mu := &sync.Mutex{}
+	return t.subscribe(func(conn *stomp.Conn) error {
+		mu.Lock()
+		start := next
+		mu.Unlock()
+
+		headers := NewQueueConfig(Stream).stompHeaders(streamName, t.opts.Prefetch)
+		headers["x-stream-offset"] = stompOffset(start)
+		return t.consume(conn, exchange, key, headers, 1, func(f stomp.Frame) AckType {
+			ack := handler(stompMessage(exchange, f))
+			o, err := strconv.ParseInt(f.Headers["x-stream-offset"], 10, 64)
+			if err == nil {
+				mu.Lock()
+				next = OffsetAt(o + 1)
+				mu.Unlock()
+			}
+			return ack
+		})
+	})
+}
+
+// DeclareStream subscribes and leaves straight away, since the plugin only
+// declares queues for subscriptions. It does so again after reconnecting,
+// in case the node we move to doesn't have the stream.
+func (t *STOMPTransport) DeclareStream(exchange, streamName, key string) error {
+	return t.subscribe(func(conn *stomp.Conn) error {
+		headers := NewQueueConfig(Stream).stompHeaders(streamName, t.opts.Prefetch)
+		headers["x-stream-offset"] = stompOffset(OffsetNext())
+		sub, err := conn.Subscribe(StompDestination(exchange, key), stomp.AckClientIndividual, headers)
+		if err != nil {
+			return fmt.Errorf("Failed to subscribe: %v", err)
+		}
+		return sub.Unsubscribe()
+	})
+}
+
+func (t *STOMPTransport) consume(
+	conn *stomp.Conn,
+	exchange string,
+	key string,
+	headers map[string]string,
+	workers int,
+	handler func(stomp.Frame) AckType,
+) error {
+	sub, err := conn.Subscribe(StompDestination(exchange, key), stomp.AckClientIndividual, headers)
+	if err != nil {
+		return fmt.Errorf("Failed to subscribe: %v", err)
+	}
+
+	for range workers {
+		go t.handleFrames(conn, sub, handler)
+	}
+
+	return nil
+}
+
+func (t *STOMPTransport) handleFrames(conn *stomp.Conn, sub *stomp.Subscription, handler func(stomp.Frame) AckType) {
+	for f := range sub.C {
+		if !t.inflight.start() {
+			return
+		}
+		ackFrame(conn, f, handler(f))
+		t.inflight.done()
+	}
+}
+
+func ackFrame(conn *stomp.Conn, f stomp.Frame, ack AckType) {
+	var err error
+	switch ack {
+	case Ack:
+		err = conn.Ack(f)
+		if err != nil {
+			log.Printf("Failed to ack message: %v", err)
+		}
+
+	case NackRequeue:
+		err = conn.Nack(f, true)
+		if err != nil {
+			log.Printf("Failed to nack message: %v", err)
+		}
+
+	case NackDiscard:
+		err = conn.Nack(f, false)
+		if err != nil {
+			log.Printf("Failed to nack message: %v", err)
+		}
+	}
+}
+
+// stompMessage takes the routing key from the destination, which the
+// plugin sets to the exchange and key the message was published with.
+func stompMessage(exchange string, f stomp.Frame) Message {
+	return Message{
+		ContentType: f.Headers["content-type"],
+		Body:        f.Body,
+		RoutingKey:  strings.TrimPrefix(f.Headers["destination"], StompDestination(exchange, "")),
+	}
+}
+
+func (t *STOMPTransport) Serve(exchange, queueName, key string, handler func(Message) (Message, error)) error {
+	return t.subscribe(func(conn *stomp.Conn) error {
+		headers := NewQueueConfig(Durable).stompHeaders(queueName, t.opts.Prefetch)
+		sub, err := conn.Subscribe(StompDestination(exchange, key), stomp.AckClientIndividual, headers)
+		if err != nil {
+			return fmt.Errorf("Failed to subscribe: %v", err)
+		}
+
+		go func() {
+			for f := range sub.C {
+				if !t.inflight.start() {
+					return
+				}
+				answerFrame(conn, exchange, f, handler)
+				t.inflight.done()
+			}
+		}()
+
+		return nil
+	})
+}
+
+func answerFrame(conn *stomp.Conn, exchange string, f stomp.Frame, handler func(Message) (Message, error)) {
+	resp, err := handler(stompMessage(exchange, f))
+	if err != nil {
+		log.Printf("Failed to handle request: %v", err)
+		conn.Nack(f, false)
+		return
+	}
+
+	// Sending to no destination is an error that would close the
+	// connection, so requests nobody waits on go unanswered
+	replyTo := f.Headers["reply-to"]
+	if replyTo != "" {
+		err = conn.Send(replyTo, resp.ContentType, resp.Body, map[string]string{
+			"correlation-id": f.Headers["correlation-id"],
+		})
+		if err != nil {
+			log.Printf("Failed to publish response: %v", err)
+		}
+	}
+
+	err = conn.Ack(f)
+	if err != nil {
+		log.Printf("Failed to ack message: %v", err)
+	}
+}
+
+// replyQueue is the current connection and its reply queue, which is
+// created the first time Call needs it.
+func (t *STOMPTransport) replyQueue() (*stomp.Conn, *stomp.Subscription, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.replies == nil {
+		replies, err := t.conn.TempQueue(stompReplyQueue)
+		if err != nil {
+			return nil, nil, err
+		}
+		t.replies = replies
+	}
+	return t.conn, t.replies, nil
+}
+
+// Call skips replies to earlier calls that timed out, which can still be
+// waiting on the shared reply queue.
+func (t *STOMPTransport) Call(exchange, key string, req Message, timeout time.Duration) (Message, error) {
+	t.callMu.Lock()
+	defer t.callMu.Unlock()
+
+	conn, replies, err := t.replyQueue()
+	if err != nil {
+		return Message{}, fmt.Errorf("Failed to consume replies: %v", err)
+	}
+
+	correlationID := strconv.FormatInt(time.Now().UnixNano(), 36)
+	err = conn.Send(StompDestination(exchange, key), req.ContentType, req.Body, map[string]string{
+		"reply-to":       replies.ID,
+		"correlation-id": correlationID,
+	})
+	if err != nil {
+		return Message{}, fmt.Errorf("Failed to publish: %v", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case f, ok := <-replies.C:
+			if !ok {
+				return Message{}, fmt.Errorf("Reply channel closed")
+			}
+			if f.Headers["correlation-id"] != correlationID {
+				continue
+			}
+			return Message{ContentType: f.Headers["content-type"], Body: f.Body}, nil
+
+		case <-timer.C:
+			return Message{}, fmt.Errorf("Timed out after %v waiting for a reply", timeout)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/stomp"
+)
+
+// stompServer stands in for RabbitMQ's STOMP plugin, handing every frame a
+// client sends to the test.
+type stompServer struct {
+	nc     net.Conn
+	frames chan stomp.Frame
+	nextID int
+}
+
+// newStompServer connects a transport to a stand-in server, with the
+// prefetch set to something other than the default.
+func newStompServer(t *testing.T) (*STOMPTransport, *stompServer) {
+	t.Helper()
+	client, server := net.Pipe()
+	s := &stompServer{nc: server, frames: make(chan stomp.Frame, 16)}
+
+	go func() {
+		defer close(s.frames)
+		r := bufio.NewReader(server)
+		for {
+			f, err := stomp.ReadFrame(r)
+			if err != nil {
+				return
+			}
+			switch f.Command {
+			case "CONNECT":
+				stomp.WriteFrame(server, stomp.NewFrame("CONNECTED", map[string]string{"version": "1.2"}, nil))
+			case "DISCONNECT":
+				stomp.WriteFrame(server, stomp.NewFrame("RECEIPT", map[string]string{"receipt-id": f.Headers["receipt"]}, nil))
+			default:
+				s.frames <- f
+			}
+		}
+	}()
+
+	opts := DialOptions{Transport: "stomp", URLs: []string{"stomp://test"}, Prefetch: 3}.withDefaults()
+	tr, err := newSTOMPTransport(opts, func(string) (*stomp.Conn, error) {
+		return stomp.NewConn(client, stomp.Options{})
+	})
+	if err != nil {
+		t.Fatalf("newSTOMPTransport: %v", err)
+	}
+	t.Cleanup(func() {
+		tr.Close()
+		server.Close()
+	})
+	return tr, s
+}
+
+func (s *stompServer) next(t *testing.T) stomp.Frame {
+	t.Helper()
+	select {
+	case f, ok := <-s.frames:
+		if !ok {
+			t.Fatal("connection closed")
+		}
+		return f
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a frame")
+		return stomp.Frame{}
+	}
+}
+
+// deliver sends a message published with key to a subscription, returning
+// its ack id.
+func (s *stompServer) deliver(t *testing.T, sub stomp.Frame, key string, body []byte) string {
+	t.Helper()
+	s.nextID++
+	ackID := strconv.Itoa(s.nextID)
+	err := stomp.WriteFrame(s.nc, stomp.NewFrame("MESSAGE", map[string]string{
+		"subscription": sub.Headers["id"],
+		"destination":  StompDestination("peril_topic", key),
+		"message-id":   ackID,
+		"ack":          ackID,
+	}, body))
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	return ackID
+}
+
+type stompTestMsg struct {
+	Text string
+}
+
+func TestSubscribeStompDeclaresQueue(t *testing.T) {
+	tr, srv := newStompServer(t)
+
+	err := SubscribeJSON(tr, "peril_topic", "army_moves.bob", "army_moves.*", Durable, func(stompTestMsg) AckType {
+		return Ack
+	})
+	if err != nil {
+		t.Fatalf("SubscribeJSON: %v", err)
+	}
+
+	sub := srv.next(t)
+	if sub.Command != "SUBSCRIBE" {
+		t.Fatalf("got %s frame, want SUBSCRIBE", sub.Command)
+	}
+	want := map[string]string{
+		"destination":            "/exchange/peril_topic/army_moves.*",
+		"ack":                    "client-individual",
+		"x-queue-name":           "army_moves.bob",
+		"durable":                "true",
+		"auto-delete":            "false",
+		"exclusive":              "false",
+		"x-dead-letter-exchange": "peril_dlx",
+		"prefetch-count":         "3",
+	}
+	for k, v := range want {
+		if sub.Headers[k] != v {
+			t.Errorf("header %s = %q, want %q", k, sub.Headers[k], v)
+		}
+	}
+}
+
+func TestSubscribeStompAcks(t *testing.T) {
+	tests := []struct {
+		ack     AckType
+		command string
+		requeue string
+	}{
+		{Ack, "ACK", ""},
+		{NackRequeue, "NACK", "true"},
+		{NackDiscard, "NACK", "false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ack.String(), func(t *testing.T) {
+			tr, srv := newStompServer(t)
+			got := make(chan stompTestMsg, 1)
+			keys := make(chan string, 1)
+			err := SubscribeJSONWithRoutingKey(tr, "peril_topic", "", "chat.*", Transient, func(m stompTestMsg, key string) AckType {
+				got <- m
+				keys <- key
+				return tt.ack
+			})
+			if err != nil {
+				t.Fatalf("SubscribeJSONWithRoutingKey: %v", err)
+			}
+			sub := srv.next(t)
+			if _, ok := sub.Headers["x-queue-name"]; ok {
+				t.Errorf("x-queue-name = %q, want the broker to name the queue", sub.Headers["x-queue-name"])
+			}
+
+			body, _ := json.Marshal(stompTestMsg{Text: "hello"})
+			ackID := srv.deliver(t, sub, "chat.global", body)
+
+			select {
+			case m := <-got:
+				if m.Text != "hello" {
+					t.Errorf("handler got %q, want hello", m.Text)
+				}
+				if key := <-keys; key != "chat.global" {
+					t.Errorf("routing key = %q, want chat.global", key)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("handler was not called")
+			}
+
+			f := srv.next(t)
+			if f.Command != tt.command || f.Headers["id"] != ackID {
+				t.Errorf("got %s id=%s, want %s id=%s", f.Command, f.Headers["id"], tt.command, ackID)
+			}
+			if tt.requeue != "" && f.Headers["requeue"] != tt.requeue {
+				t.Errorf("requeue = %q, want %q", f.Headers["requeue"], tt.requeue)
+			}
+		})
+	}
+}
+
+func TestSubscribeStompDiscardsUndecodable(t *testing.T) {
+	tr, srv := newStompServer(t)
+	called := make(chan struct{}, 1)
+	err := SubscribeGob(tr, "peril_topic", "q", "k", Transient, func(stompTestMsg) AckType {
+		called <- struct{}{}
+		return Ack
+	})
+	if err != nil {
+		t.Fatalf("SubscribeGob: %v", err)
+	}
+	sub := srv.next(t)
+
+	ackID := srv.deliver(t, sub, "k", []byte("not gob"))
+
+	f := srv.next(t)
+	if f.Command != "NACK" || f.Headers["id"] != ackID || f.Headers["requeue"] != "false" {
+		t.Errorf("got %s %v, want NACK id=%s requeue=false", f.Command, f.Headers, ackID)
+	}
+	select {
+	case <-called:
+		t.Error("handler called for a message that could not be decoded")
+	default:
+	}
+}
+
+func TestPublishStompJSON(t *testing.T) {
+	tr, srv := newStompServer(t)
+
+	err := PublishJSON(tr, "peril_topic", "chat.global", stompTestMsg{Text: "hi"})
+	if err != nil {
+		t.Fatalf("PublishJSON: %v", err)
+	}
+
+	f := srv.next(t)
+	if f.Command != "SEND" {
+		t.Fatalf("got %s frame, want SEND", f.Command)
+	}
+	if f.Headers["destination"] != "/exchange/peril_topic/chat.global" {
+		t.Errorf("destination = %q", f.Headers["destination"])
+	}
+	if f.Headers["content-type"] != "application/json" {
+		t.Errorf("content-type = %q", f.Headers["content-type"])
+	}
+	var m stompTestMsg
+	err = json.Unmarshal(f.Body, &m)
+	if err != nil || m.Text != "hi" {
+		t.Errorf("body = %q, want a message saying hi", f.Body)
+	}
+}
+
+func TestSubscribeStompRejectsStreams(t *testing.T) {
+	tr, _ := newStompServer(t)
+	err := SubscribeJSON(tr, "peril_topic", "q", "k", Stream, func(stompTestMsg) AckType {
+		return Ack
+	})
+	if err == nil {
+		t.Fatal("SubscribeJSON succeeded for a stream queue")
+	}
+}
+
+func TestSubscribeStompStreamOffset(t *testing.T) {
+	tests := []struct {
+		offset StreamOffset
+		want   string
+	}{
+		{OffsetFirst(), "first"},
+		{OffsetNext(), "next"},
+		{OffsetAt(42), "offset=42"},
+		{OffsetTimestamp(time.Unix(1700000000, 0)), "timestamp=1700000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			tr, srv := newStompServer(t)
+			err := SubscribeStreamJSON(tr, "peril_topic", "game_logs", "game_logs.*", tt.offset, func(stompTestMsg) AckType {
+				return Ack
+			})
+			if err != nil {
+				t.Fatalf("SubscribeStreamJSON: %v", err)
+			}
+
+			sub := srv.next(t)
+			if sub.Headers["x-stream-offset"] != tt.want || sub.Headers["x-queue-type"] != "stream" {
+				t.Errorf("x-stream-offset = %q and x-queue-type = %q, want %q on a stream", sub.Headers["x-stream-offset"], sub.Headers["x-queue-type"], tt.want)
+			}
+		})
+	}
+}
+
+func TestServeStompReplies(t *testing.T) {
+	tr, srv := newStompServer(t)
+	err := tr.Serve("peril_direct", "peril_rpc", "leaderboard", func(req Message) (Message, error) {
+		return Message{ContentType: "text/plain", Body: append([]byte("re: "), req.Body...)}, nil
+	})
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	sub := srv.next(t)
+
+	err = stomp.WriteFrame(srv.nc, stomp.NewFrame("MESSAGE", map[string]string{
+		"subscription":   sub.Headers["id"],
+		"destination":    StompDestination("peril_direct", "leaderboard"),
+		"ack":            "1",
+		"reply-to":       "/temp-queue/peril_replies",
+		"correlation-id": "abc",
+	}, []byte("hi")))
+	if err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+
+	reply := srv.next(t)
+	if reply.Command != "SEND" || reply.Headers["destination"] != "/temp-queue/peril_replies" || reply.Headers["correlation-id"] != "abc" {
+		t.Errorf("got %s %v, want a SEND to the reply queue", reply.Command, reply.Headers)
+	}
+	if string(reply.Body) != "re: hi" {
+		t.Errorf("reply = %q, want re: hi", reply.Body)
+	}
+	if f := srv.next(t); f.Command != "ACK" {
+		t.Errorf("got %s frame, want ACK", f.Command)
+	}
+}
+
+func TestCallStompMatchesReply(t *testing.T) {
+	tr, srv := newStompServer(t)
+
+	type result struct {
+		msg Message
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		msg, err := tr.Call("peril_direct", "leaderboard", Message{ContentType: "text/plain", Body: []byte("hi")}, time.Second)
+		done <- result{msg, err}
+	}()
+
+	req := srv.next(t)
+	replyTo := req.Headers["reply-to"]
+	for _, id := range []string{"stale", req.Headers["correlation-id"]} {
+		err := stomp.WriteFrame(srv.nc, stomp.NewFrame("MESSAGE", map[string]string{
+			"subscription":   replyTo,
+			"destination":    replyTo,
+			"correlation-id": id,
+		}, []byte(id)))
+		if err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+	}
+
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("Call: %v", r.err)
+	}
+	if string(r.msg.Body) != req.Headers["correlation-id"] {
+		t.Errorf("Call returned %q, want the reply to this call", r.msg.Body)
+	}
+}
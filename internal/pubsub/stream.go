@@ -0,0 +1,69 @@
+package pubsub
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// StreamOffset is where a stream subscriber starts reading.
+type StreamOffset struct {
+	value any
+}
+
+// OffsetFirst starts at the oldest message still held by the stream.
+func OffsetFirst() StreamOffset {
+	return StreamOffset{value: "first"}
+}
+
+// OffsetLast starts at the most recent chunk of messages.
+func OffsetLast() StreamOffset {
+	return StreamOffset{value: "last"}
+}
+
+// OffsetNext only delivers messages published after subscribing.
+func OffsetNext() StreamOffset {
+	return StreamOffset{value: "next"}
+}
+
+// OffsetTimestamp starts at the first message published at or after t.
+func OffsetTimestamp(t time.Time) StreamOffset {
+	return StreamOffset{value: t}
+}
+
+// OffsetAt starts at an absolute position in the stream.
+func OffsetAt(offset int64) StreamOffset {
+	return StreamOffset{value: offset}
+}
+
+func (o StreamOffset) String() string {
+	if t, ok := o.value.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(o.value)
+}
+
+// ParseStreamOffset accepts first, last, next, an RFC 3339 timestamp or an
+// absolute offset.
+func ParseStreamOffset(s string) (StreamOffset, error) {
+	switch s {
+	case "first":
+		return OffsetFirst(), nil
+	case "last":
+		return OffsetLast(), nil
+	case "next":
+		return OffsetNext(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return OffsetTimestamp(t), nil
+	}
+
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err == nil && offset >= 0 {
+		return OffsetAt(offset), nil
+	}
+
+	return StreamOffset{}, fmt.Errorf("Invalid stream offset: %q", s)
+}
@@ -0,0 +1,86 @@
+package pubsub
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+const (
+	AuthPlain    = "plain"
+	AuthExternal = "external"
+)
+
+// TLSOptions are paths to PEM files and the name to verify the broker's
+// certificate against. Leaving them empty uses the system's roots.
+type TLSOptions struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+}
+
+func (o TLSOptions) enabled() bool {
+	return o != (TLSOptions{})
+}
+
+// checkAuth rejects options that would connect less securely than asked,
+// like TLS options on a plaintext amqp:// or stomp:// URL, which would
+// otherwise be silently ignored.
+func (o DialOptions) checkAuth(brokerURL string) error {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return fmt.Errorf("Invalid broker URL: %v", err)
+	}
+	if o.Transport == "amqp" && o.TLS.enabled() && u.Scheme != "amqps" {
+		return fmt.Errorf("TLS options need an amqps:// URL, not %s://", u.Scheme)
+	}
+	if o.Transport == "stomp" && o.TLS.enabled() && u.Scheme != "stomps" {
+		return fmt.Errorf("TLS options need a stomps:// URL, not %s://", u.Scheme)
+	}
+
+	switch o.Auth {
+	case "", AuthPlain:
+	case AuthExternal:
+		if o.TLS.CertFile == "" {
+			return errors.New("External auth needs a client certificate")
+		}
+		if o.Username != "" || o.Password != "" {
+			return errors.New("External auth takes the user from the client certificate, not a username or password")
+		}
+	default:
+		return fmt.Errorf("Unknown auth mechanism: %q", o.Auth)
+	}
+	return nil
+}
+
+// config builds the TLS config for the broker connection, which is nil if
+// no options are set.
+func (o TLSOptions) config() (*tls.Config, error) {
+	if !o.enabled() {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{ServerName: o.ServerName, MinVersion: tls.VersionTLS12}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA bundle: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s", o.CAFile)
+		}
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
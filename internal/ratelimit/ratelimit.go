@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter is a set of token buckets, one per key. Each bucket holds up to
+// burst tokens and refills at rate tokens per second. A full bucket is the
+// same as a new one, so buckets are dropped once they have refilled.
+type Limiter struct {
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	refill  time.Duration
+	swept   time.Time
+	mu      *sync.Mutex
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	l := &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+		mu:      &sync.Mutex{},
+	}
+	if rate > 0 {
+		l.refill = time.Duration(float64(burst) / rate * float64(time.Second))
+	}
+	return l
+}
+
+// Allow takes a token from key's bucket, reporting whether one was available.
+func (l *Limiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.refill > 0 && now.Sub(l.swept) >= l.refill {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops the buckets that have refilled since they were last used. It
+// runs at most once per refill period, by which time every bucket that was
+// idle for the whole period is full.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
@@ -6,8 +6,47 @@ type PlayingState struct {
 	IsPaused bool
 }
 
+type Join struct {
+	Username string
+}
+
+type Leave struct {
+	Username string
+}
+
 type GameLog struct {
 	CurrentTime time.Time
 	Message     string
 	Username    string
 }
+
+type ChatChannel string
+
+const (
+	ChatGlobal ChatChannel = "global"
+	ChatDirect ChatChannel = "dm"
+	ChatTeam   ChatChannel = "team"
+)
+
+type ChatMessage struct {
+	CurrentTime time.Time
+	Username    string
+	Channel     ChatChannel
+	Target      string
+	Message     string
+}
+
+type AdminKind string
+
+const (
+	AdminKicked    AdminKind = "kicked"
+	AdminBanned    AdminKind = "banned"
+	AdminBroadcast AdminKind = "broadcast"
+)
+
+// AdminMessage is sent by the server operator to a single player.
+type AdminMessage struct {
+	Kind    AdminKind
+	Message string
+	Until   time.Time
+}
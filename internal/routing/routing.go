@@ -3,11 +3,52 @@ package routing
 const (
 	ArmyMovesPrefix = "army_moves"
 
+	// VisibleMovesPrefix delivers army moves, relayed by the server, to only
+	// the players who can see them
+	VisibleMovesPrefix = "visible_moves"
+
 	WarRecognitionsPrefix = "war"
 
 	PauseKey = "pause"
 
+	GameOverKey = "game_over"
+
+	LeaderboardRPCKey = "leaderboard_rpc"
+
+	AdminPrefix = "admin"
+
+	// GameLogSubmitPrefix is where players send game logs for the server to
+	// moderate. Only the ones it accepts are published under GameLogSlug,
+	// so every reader of the game log sees the same moderated entries.
+	GameLogSubmitPrefix = "game_log_submit"
+
 	GameLogSlug = "game_logs"
+
+	// GameLogStream retains every game log so independent readers can each
+	// replay it from any offset
+	GameLogStream = "game_logs_stream"
+
+	// DiplomacyPrefix is followed by the sender and then the player the
+	// message is for, so the server can tell who really sent it
+	DiplomacyPrefix = "diplomacy"
+
+	ChatPrefix       = "chat"
+	ChatSubmitPrefix = "chat_submit"
+
+	JoinPrefix   = "join"
+	LeavePrefix  = "leave"
+	SpawnsPrefix = "spawns"
+	IncomePrefix = "income"
+
+	WarResultsPrefix = "war_results"
+
+	// CasualtiesPrefix tells players about units they lost in a war someone
+	// else resolved
+	CasualtiesPrefix = "casualties"
+
+	ViewPrefix = "view"
+
+	RestorePrefix = "restore"
 )
 
 const (
@@ -0,0 +1,317 @@
+// Package stomp is a small STOMP 1.2 client, enough to publish and
+// subscribe through RabbitMQ's STOMP plugin.
+package stomp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	disconnectTimeout = 5 * time.Second
+	subscriptionQueue = 16
+)
+
+// AckMode controls how a subscription's messages are acknowledged.
+type AckMode string
+
+const (
+	// AckAuto treats messages as acknowledged as soon as they are sent.
+	AckAuto AckMode = "auto"
+	// AckClient acknowledges a message and every message before it.
+	AckClient AckMode = "client"
+	// AckClientIndividual acknowledges one message at a time.
+	AckClientIndividual AckMode = "client-individual"
+)
+
+type Options struct {
+	Login    string
+	Passcode string
+	Host     string
+}
+
+// Conn is a connection to a STOMP server. Messages are read on their own
+// goroutine and routed to the subscription they belong to.
+type Conn struct {
+	nc       net.Conn
+	r        *bufio.Reader
+	subs     map[string]*sub
+	receipts map[string]chan struct{}
+	nextID   int
+	closed   chan struct{}
+	err      error
+	mu       *sync.Mutex
+	writeMu  *sync.Mutex
+}
+
+// Subscription receives the MESSAGE frames sent to one destination. C is
+// closed when the connection ends, and stops receiving after Unsubscribe.
+type Subscription struct {
+	ID   string
+	C    <-chan Frame
+	conn *Conn
+	temp bool
+}
+
+// sub is a subscription as seen by the read loop, which is the only
+// goroutine that sends on or closes ch.
+type sub struct {
+	ch   chan Frame
+	done chan struct{}
+}
+
+func Dial(addr string, opts Options) (*Conn, error) {
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewConn(nc, opts)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewConn performs the STOMP handshake over an existing network connection.
+func NewConn(nc net.Conn, opts Options) (*Conn, error) {
+	c := &Conn{
+		nc:       nc,
+		r:        bufio.NewReader(nc),
+		subs:     map[string]*sub{},
+		receipts: map[string]chan struct{}{},
+		closed:   make(chan struct{}),
+		mu:       &sync.Mutex{},
+		writeMu:  &sync.Mutex{},
+	}
+
+	host := opts.Host
+	if host == "" {
+		host = "/"
+	}
+	headers := map[string]string{
+		"accept-version": "1.2",
+		"host":           host,
+		"heart-beat":     "0,0",
+	}
+	if opts.Login != "" {
+		headers["login"] = opts.Login
+		headers["passcode"] = opts.Passcode
+	}
+	err := c.write(NewFrame("CONNECT", headers, nil))
+	if err != nil {
+		return nil, fmt.Errorf("could not connect: %v", err)
+	}
+
+	f, err := ReadFrame(c.r)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect: %v", err)
+	}
+	if f.Command == "ERROR" {
+		return nil, fmt.Errorf("could not connect: %s", f.Headers["message"])
+	}
+	if f.Command != "CONNECTED" {
+		return nil, fmt.Errorf("could not connect: unexpected %s frame", f.Command)
+	}
+
+	go c.readLoop()
+	return c, nil
+}
+
+// Send publishes body to a destination.
+func (c *Conn) Send(destination, contentType string, body []byte, headers map[string]string) error {
+	h := map[string]string{}
+	for k, v := range headers {
+		h[k] = v
+	}
+	h["destination"] = destination
+	if contentType != "" {
+		h["content-type"] = contentType
+	}
+	return c.write(NewFrame("SEND", h, body))
+}
+
+func (c *Conn) Subscribe(destination string, ack AckMode, headers map[string]string) (*Subscription, error) {
+	s := &sub{ch: make(chan Frame, subscriptionQueue), done: make(chan struct{})}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := strconv.Itoa(c.nextID)
+	c.subs[id] = s
+	c.mu.Unlock()
+
+	h := map[string]string{}
+	for k, v := range headers {
+		h[k] = v
+	}
+	h["id"] = id
+	h["destination"] = destination
+	h["ack"] = string(ack)
+	err := c.write(NewFrame("SUBSCRIBE", h, nil))
+	if err != nil {
+		c.removeSub(id)
+		return nil, err
+	}
+
+	return &Subscription{ID: id, C: s.ch, conn: c}, nil
+}
+
+// TempQueue receives what is sent to /temp-queue/name. RabbitMQ creates the
+// queue the first time a frame we send names it as its reply-to, and
+// delivers from it on a subscription whose ID is the destination, so there
+// is nothing to subscribe to. The queue lasts as long as the connection.
+func (c *Conn) TempQueue(name string) (*Subscription, error) {
+	s := &sub{ch: make(chan Frame, subscriptionQueue), done: make(chan struct{})}
+	id := "/temp-queue/" + name
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	if _, ok := c.subs[id]; ok {
+		return nil, fmt.Errorf("already receiving from %s", id)
+	}
+	c.subs[id] = s
+	return &Subscription{ID: id, C: s.ch, conn: c, temp: true}, nil
+}
+
+func (s *Subscription) Unsubscribe() error {
+	if s.temp {
+		s.conn.removeSub(s.ID)
+		return nil
+	}
+	err := s.conn.write(NewFrame("UNSUBSCRIBE", map[string]string{"id": s.ID}, nil))
+	s.conn.removeSub(s.ID)
+	return err
+}
+
+// Ack acknowledges a message received on a client or client-individual
+// subscription.
+func (c *Conn) Ack(msg Frame) error {
+	return c.write(NewFrame("ACK", map[string]string{"id": msg.Headers["ack"]}, nil))
+}
+
+// Nack rejects a message. RabbitMQ honours the requeue header; without it
+// the message is requeued.
+func (c *Conn) Nack(msg Frame, requeue bool) error {
+	return c.write(NewFrame("NACK", map[string]string{
+		"id":      msg.Headers["ack"],
+		"requeue": strconv.FormatBool(requeue),
+	}, nil))
+}
+
+// Done is closed when the connection ends, after which Err says why.
+func (c *Conn) Done() <-chan struct{} {
+	return c.closed
+}
+
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close disconnects gracefully, waiting for the server to confirm it has
+// handled everything we sent.
+func (c *Conn) Close() error {
+	receipt := make(chan struct{})
+	c.mu.Lock()
+	c.receipts["disconnect"] = receipt
+	c.mu.Unlock()
+
+	err := c.write(NewFrame("DISCONNECT", map[string]string{"receipt": "disconnect"}, nil))
+	if err == nil {
+		select {
+		case <-receipt:
+		case <-c.closed:
+		case <-time.After(disconnectTimeout):
+		}
+	}
+
+	closeErr := c.nc.Close()
+	<-c.closed
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (c *Conn) readLoop() {
+	var err error
+	defer func() {
+		c.mu.Lock()
+		c.err = err
+		for _, s := range c.subs {
+			close(s.ch)
+		}
+		c.subs = map[string]*sub{}
+		c.mu.Unlock()
+		close(c.closed)
+	}()
+
+	for {
+		var f Frame
+		f, err = ReadFrame(c.r)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				err = errors.New("connection closed")
+			}
+			return
+		}
+
+		switch f.Command {
+		case "MESSAGE":
+			c.mu.Lock()
+			s, ok := c.subs[f.Headers["subscription"]]
+			c.mu.Unlock()
+			if !ok {
+				continue
+			}
+			select {
+			case s.ch <- f:
+			case <-s.done:
+			}
+
+		case "RECEIPT":
+			c.mu.Lock()
+			receipt, ok := c.receipts[f.Headers["receipt-id"]]
+			delete(c.receipts, f.Headers["receipt-id"])
+			c.mu.Unlock()
+			if ok {
+				close(receipt)
+			}
+
+		case "ERROR":
+			err = fmt.Errorf("server error: %s", f.Headers["message"])
+			log.Printf("STOMP %v\n", err)
+			c.nc.Close()
+			return
+		}
+	}
+}
+
+func (c *Conn) removeSub(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.subs[id]; ok {
+		close(s.done)
+		delete(c.subs, id)
+	}
+}
+
+func (c *Conn) write(f Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return WriteFrame(c.nc, f)
+}
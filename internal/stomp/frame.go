@@ -0,0 +1,136 @@
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Frame is a single STOMP 1.2 frame.
+type Frame struct {
+	Command string
+	Headers map[string]string
+	Body    []byte
+}
+
+func NewFrame(command string, headers map[string]string, body []byte) Frame {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	return Frame{Command: command, Headers: headers, Body: body}
+}
+
+// WriteFrame writes f to w. CONNECT frames are written without escaping, as
+// the spec requires.
+func WriteFrame(w io.Writer, f Frame) error {
+	var buf bytes.Buffer
+	buf.WriteString(f.Command)
+	buf.WriteByte('\n')
+	for k, v := range f.Headers {
+		if k == "content-length" {
+			continue
+		}
+		if f.Command != "CONNECT" {
+			k, v = escape(k), escape(v)
+		}
+		buf.WriteString(k)
+		buf.WriteByte(':')
+		buf.WriteString(v)
+		buf.WriteByte('\n')
+	}
+	if len(f.Body) > 0 {
+		buf.WriteString("content-length:")
+		buf.WriteString(strconv.Itoa(len(f.Body)))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.Write(f.Body)
+	buf.WriteByte(0)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadFrame reads the next frame from r, skipping heart-beat newlines.
+func ReadFrame(r *bufio.Reader) (Frame, error) {
+	var command string
+	for command == "" {
+		line, err := readLine(r)
+		if err != nil {
+			return Frame{}, err
+		}
+		command = line
+	}
+
+	f := NewFrame(command, nil, nil)
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return Frame{}, err
+		}
+		if line == "" {
+			break
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			return Frame{}, fmt.Errorf("malformed header: %q", line)
+		}
+		k, v = unescape(k), unescape(v)
+		// Repeated headers keep the first value
+		if _, ok := f.Headers[k]; !ok {
+			f.Headers[k] = v
+		}
+	}
+
+	if cl, ok := f.Headers["content-length"]; ok {
+		n, err := strconv.Atoi(cl)
+		if err != nil || n < 0 {
+			return Frame{}, fmt.Errorf("invalid content-length: %q", cl)
+		}
+		f.Body = make([]byte, n)
+		_, err = io.ReadFull(r, f.Body)
+		if err != nil {
+			return Frame{}, err
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return Frame{}, err
+		}
+		if b != 0 {
+			return Frame{}, fmt.Errorf("frame body is longer than its content-length")
+		}
+		return f, nil
+	}
+
+	body, err := r.ReadBytes(0)
+	if err != nil {
+		return Frame{}, err
+	}
+	f.Body = body[:len(body)-1]
+	return f, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+var (
+	escaper   = strings.NewReplacer(`\`, `\\`, "\r", `\r`, "\n", `\n`, ":", `\c`)
+	unescaper = strings.NewReplacer(`\\`, `\`, `\r`, "\r", `\n`, "\n", `\c`, ":")
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
@@ -0,0 +1,58 @@
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		f    Frame
+	}{
+		{"no body", NewFrame("SUBSCRIBE", map[string]string{"id": "1", "destination": "/exchange/peril_topic/army_moves.*"}, nil)},
+		{"escaped headers", NewFrame("SEND", map[string]string{"note": "a:b\\c\nd\re"}, []byte("hello"))},
+		{"body with NUL", NewFrame("MESSAGE", map[string]string{"subscription": "1"}, []byte("gob\x00bytes"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteFrame(&buf, tt.f)
+			if err != nil {
+				t.Fatalf("WriteFrame: %v", err)
+			}
+			got, err := ReadFrame(bufio.NewReader(&buf))
+			if err != nil {
+				t.Fatalf("ReadFrame: %v", err)
+			}
+			if got.Command != tt.f.Command || !bytes.Equal(got.Body, tt.f.Body) {
+				t.Errorf("got %s %q, want %s %q", got.Command, got.Body, tt.f.Command, tt.f.Body)
+			}
+			for k, v := range tt.f.Headers {
+				if got.Headers[k] != v {
+					t.Errorf("header %s = %q, want %q", k, got.Headers[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestReadFrameSkipsHeartBeats(t *testing.T) {
+	r := bufio.NewReader(bytes.NewBufferString("\n\r\nRECEIPT\nreceipt-id:disconnect\n\n\x00"))
+	f, err := ReadFrame(r)
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if f.Command != "RECEIPT" || f.Headers["receipt-id"] != "disconnect" {
+		t.Errorf("got %s %v, want a RECEIPT for disconnect", f.Command, f.Headers)
+	}
+}
+
+func TestReadFrameRejectsLongBody(t *testing.T) {
+	r := bufio.NewReader(bytes.NewBufferString("MESSAGE\ncontent-length:2\n\nabc\x00"))
+	_, err := ReadFrame(r)
+	if err == nil {
+		t.Fatal("ReadFrame accepted a body longer than its content-length")
+	}
+}
@@ -0,0 +1,30 @@
+#!/bin/bash
+
+start_or_run () {
+    docker inspect peril_nats > /dev/null 2>&1
+
+    if [ $? -eq 0 ]; then
+        echo "Starting Peril NATS container..."
+        docker start peril_nats
+    else
+        echo "Peril NATS container not found, creating a new one..."
+        docker run -d --name peril_nats -p 4222:4222 nats:2.10 -js
+    fi
+}
+
+case "$1" in
+    start)
+        start_or_run
+        ;;
+    stop)
+        echo "Stopping Peril NATS container..."
+        docker stop peril_nats
+        ;;
+    logs)
+        echo "Fetching logs for Peril NATS container..."
+        docker logs -f peril_nats
+        ;;
+    *)
+        echo "Usage: $0 {start|stop|logs}"
+        exit 1
+esac